@@ -0,0 +1,147 @@
+package annotations
+
+import (
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/juruen/rmapi/log"
+	"github.com/unidoc/unipdf/v3/extractor"
+	pdf "github.com/unidoc/unipdf/v3/model"
+)
+
+// minSimilarity is the share of words two pages need in common to be considered the same page
+const minSimilarity = 0.5
+
+// MatchPages pairs the pages of a revised PDF with the pages of the original one
+// by comparing their text. The result has an entry per page of the revised document
+// with the index of the matching page in the original document, or -1.
+// Pages are matched in order, so moving pages around is not detected.
+func MatchPages(original, revised io.ReadSeeker) ([]int, error) {
+	originalWords, err := pageWords(original)
+	if err != nil {
+		return nil, err
+	}
+
+	revisedWords, err := pageWords(revised)
+	if err != nil {
+		return nil, err
+	}
+
+	if !hasWords(originalWords) && !hasWords(revisedWords) {
+		log.Warning.Println("no text found in the documents, matching pages by position")
+		matches := make([]int, len(revisedWords))
+		for i := range matches {
+			matches[i] = -1
+			if i < len(originalWords) {
+				matches[i] = i
+			}
+		}
+		return matches, nil
+	}
+
+	return matchWords(originalWords, revisedWords), nil
+}
+
+// matchWords greedily picks for every revised page the most similar original page
+// that comes after the previous match
+func matchWords(original, revised []map[string]bool) []int {
+	matches := make([]int, len(revised))
+	next := 0
+	for i, words := range revised {
+		matches[i] = -1
+		best := minSimilarity
+		for j := next; j < len(original); j++ {
+			if s := similarity(words, original[j]); s >= best {
+				best = s
+				matches[i] = j
+				if s == 1 {
+					break
+				}
+			}
+		}
+		if matches[i] >= 0 {
+			next = matches[i] + 1
+		}
+	}
+
+	return matches
+}
+
+// similarity is the Jaccard index of two sets of words
+func similarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	common := 0
+	for w := range a {
+		if b[w] {
+			common++
+		}
+	}
+
+	return float64(common) / float64(len(a)+len(b)-common)
+}
+
+func hasWords(pages []map[string]bool) bool {
+	for _, p := range pages {
+		if len(p) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// pageWords extracts the set of lowercase words of every page of a PDF
+func pageWords(r io.ReadSeeker) ([]map[string]bool, error) {
+	reader, err := pdf.NewPdfReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	numPages, err := reader.GetNumPages()
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]map[string]bool, numPages)
+	for i := 0; i < numPages; i++ {
+		pages[i] = make(map[string]bool)
+
+		page, err := reader.GetPage(i + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		ex, err := extractor.New(page)
+		if err != nil {
+			return nil, err
+		}
+
+		text, err := ex.ExtractText()
+		if err != nil {
+			log.Warning.Printf("can't extract text of page %d: %v", i+1, err)
+			continue
+		}
+
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, w := range words {
+			pages[i][w] = true
+		}
+	}
+
+	return pages, nil
+}
+
+// PageCount returns the number of pages of a PDF
+func PageCount(r io.ReadSeeker) (int, error) {
+	reader, err := pdf.NewPdfReader(r)
+	if err != nil {
+		return 0, err
+	}
+
+	return reader.GetNumPages()
+}
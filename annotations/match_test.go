@@ -0,0 +1,54 @@
+package annotations
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func words(s ...string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range s {
+		m[w] = true
+	}
+	return m
+}
+
+func TestMatchWords(t *testing.T) {
+	original := []map[string]bool{
+		words("introduction", "of", "the", "book"),
+		words("chapter", "one", "begins", "here"),
+		words("chapter", "two", "begins", "here"),
+	}
+	revised := []map[string]bool{
+		words("introduction", "of", "the", "new", "book"),
+		words("a", "completely", "new", "page"),
+		words("chapter", "two", "begins", "here"),
+	}
+
+	assert.Equal(t, []int{0, -1, 2}, matchWords(original, revised))
+}
+
+func TestMatchPagesSameDocument(t *testing.T) {
+	original, err := os.Open("testfiles/a4.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer original.Close()
+
+	revised, err := os.Open("testfiles/a4.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer revised.Close()
+
+	matches, err := MatchPages(original, revised)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, m := range matches {
+		assert.Equal(t, i, m)
+	}
+}
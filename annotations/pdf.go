@@ -23,7 +23,8 @@ const (
 	DeviceHeight = 1872
 )
 
-var rmPageSize = creator.PageSize{445, 594}
+// RmPageSize is the page size, in points, matching the device screen
+var RmPageSize = creator.PageSize{445, 594}
 
 type PdfGenerator struct {
 	zipName        string
@@ -81,7 +82,7 @@ func (p *PdfGenerator) Generate() error {
 	c := creator.New()
 	if p.template {
 		// use the standard page size
-		c.SetPageSize(rmPageSize)
+		c.SetPageSize(RmPageSize)
 	}
 
 	if p.pdfReader != nil && p.options.AllPages {
@@ -0,0 +1,171 @@
+package annotations
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+
+	shlex "github.com/flynn-archive/go-shlex"
+	"github.com/juruen/rmapi/encoding/rm"
+	"github.com/juruen/rmapi/log"
+)
+
+// RecognizerEnvVar names the environment variable holding the default
+// handwriting recognition command
+const RecognizerEnvVar = "RMAPI_HWR_CMD"
+
+// imagePlaceholder is replaced by the path of the rendered page in a recognizer command
+const imagePlaceholder = "{}"
+
+// Recognizer turns the strokes of a page into text
+type Recognizer interface {
+	Recognize(page *rm.Rm) (string, error)
+}
+
+// CommandRecognizer recognizes handwriting by rendering the page to a PNG image
+// and running an external command (e.g. a local OCR/HWR model) on it.
+// The path of the image replaces {} in the arguments or is appended when there is
+// no placeholder. Whatever the command prints to stdout is the recognized text.
+type CommandRecognizer struct {
+	Command string
+	Args    []string
+}
+
+// NewCommandRecognizer creates a CommandRecognizer from a command line
+// such as "tesseract {} stdout"
+func NewCommandRecognizer(cmdLine string) (*CommandRecognizer, error) {
+	fields, err := shlex.Split(cmdLine)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("empty recognizer command")
+	}
+
+	return &CommandRecognizer{Command: fields[0], Args: fields[1:]}, nil
+}
+
+// DefaultRecognizer returns the recognizer configured through RMAPI_HWR_CMD
+func DefaultRecognizer() (Recognizer, error) {
+	cmdLine := os.Getenv(RecognizerEnvVar)
+	if cmdLine == "" {
+		return nil, fmt.Errorf("no handwriting recognizer configured, set %s", RecognizerEnvVar)
+	}
+
+	return NewCommandRecognizer(cmdLine)
+}
+
+func (r *CommandRecognizer) Recognize(page *rm.Rm) (string, error) {
+	tmp, err := os.CreateTemp("", "rmapipage*.png")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = png.Encode(tmp, RenderPage(page))
+	tmp.Close()
+	if err != nil {
+		return "", err
+	}
+
+	args := make([]string, 0, len(r.Args)+1)
+	replaced := false
+	for _, a := range r.Args {
+		if strings.Contains(a, imagePlaceholder) {
+			a = strings.ReplaceAll(a, imagePlaceholder, tmp.Name())
+			replaced = true
+		}
+		args = append(args, a)
+	}
+	if !replaced {
+		args = append(args, tmp.Name())
+	}
+
+	log.Trace.Println("running recognizer", r.Command, args)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(r.Command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("recognizer failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// RenderPage rasterizes the strokes of a page in black on a white
+// background of the device size. Erased and highlighted strokes are skipped
+// as they don't carry any handwriting.
+func RenderPage(page *rm.Rm) image.Image {
+	img := image.NewGray(image.Rect(0, 0, DeviceWidth, DeviceHeight))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+
+	for _, layer := range page.Layers {
+		for _, line := range layer.Lines {
+			switch line.BrushType {
+			case rm.Eraser, rm.EraseArea, rm.Highlighter, rm.HighlighterV5:
+				continue
+			}
+
+			for i, p := range line.Points {
+				radius := float64(p.Width) / 2
+				if radius < 1 {
+					radius = 1
+				}
+				if i == 0 {
+					drawDisc(img, float64(p.X), float64(p.Y), radius)
+					continue
+				}
+				prev := line.Points[i-1]
+				drawSegment(img, float64(prev.X), float64(prev.Y), float64(p.X), float64(p.Y), radius)
+			}
+		}
+	}
+
+	return img
+}
+
+// drawSegment stamps discs along a segment to get a line of the given thickness
+func drawSegment(img *image.Gray, x1, y1, x2, y2, radius float64) {
+	dist := math.Hypot(x2-x1, y2-y1)
+	steps := int(math.Ceil(dist))
+	if steps == 0 {
+		steps = 1
+	}
+	for s := 0; s <= steps; s++ {
+		t := float64(s) / float64(steps)
+		drawDisc(img, x1+(x2-x1)*t, y1+(y2-y1)*t, radius)
+	}
+}
+
+func drawDisc(img *image.Gray, cx, cy, radius float64) {
+	bounds := img.Bounds()
+	minX := int(math.Floor(cx - radius))
+	maxX := int(math.Ceil(cx + radius))
+	minY := int(math.Floor(cy - radius))
+	maxY := int(math.Ceil(cy + radius))
+
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			if !(image.Point{x, y}.In(bounds)) {
+				continue
+			}
+			dx := float64(x) - cx
+			dy := float64(y) - cy
+			if dx*dx+dy*dy <= radius*radius {
+				img.SetGray(x, y, color.Gray{0})
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package annotations
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/juruen/rmapi/archive"
+	"github.com/juruen/rmapi/log"
+)
+
+type Transcriber struct {
+	zipName        string
+	outputFilePath string
+	title          string
+	recognizer     Recognizer
+}
+
+func CreateTranscriber(zipName, outputFilePath, title string, recognizer Recognizer) *Transcriber {
+	return &Transcriber{zipName: zipName, outputFilePath: outputFilePath, title: title, recognizer: recognizer}
+}
+
+// Transcribe runs the recognizer on every page with strokes and writes
+// a Markdown file with a section per page
+func (t *Transcriber) Transcribe() error {
+	file, err := os.Open(t.zipName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	zip := archive.NewZip()
+	if err = zip.Read(file, fi.Size()); err != nil {
+		return err
+	}
+
+	if len(zip.Pages) == 0 {
+		return errors.New("the document has no pages")
+	}
+
+	out, err := os.Create(t.outputFilePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	if t.title != "" {
+		fmt.Fprintf(w, "# %s\n\n", t.title)
+	}
+
+	for i, page := range zip.Pages {
+		if page.Data == nil {
+			continue
+		}
+
+		log.Info.Println("transcribing page", i+1)
+		text, err := t.recognizer.Recognize(page.Data)
+		if err != nil {
+			return fmt.Errorf("page %d: %v", i+1, err)
+		}
+
+		fmt.Fprintf(w, "## Page %d\n\n", i+1)
+		if text != "" {
+			fmt.Fprintf(w, "%s\n\n", text)
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,80 @@
+package annotations
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/juruen/rmapi/encoding/rm"
+)
+
+type countingRecognizer struct {
+	pages int
+}
+
+func (r *countingRecognizer) Recognize(page *rm.Rm) (string, error) {
+	r.pages++
+	return "hello", nil
+}
+
+func TestTranscribe(t *testing.T) {
+	outfile := filepath.Join(t.TempDir(), "strange.md")
+	recognizer := &countingRecognizer{}
+	transcriber := CreateTranscriber("testfiles/strange.zip", outfile, "strange", recognizer)
+
+	if err := transcriber.Transcribe(); err != nil {
+		t.Fatal(err)
+	}
+
+	if recognizer.pages != 2 {
+		t.Errorf("expected 2 pages with strokes, got %d", recognizer.pages)
+	}
+
+	md, err := os.ReadFile(outfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# strange\n\n## Page 1\n\nhello\n\n## Page 3\n\nhello\n\n"
+	if string(md) != expected {
+		t.Errorf("unexpected markdown %q", string(md))
+	}
+}
+
+func TestCommandRecognizer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs echo")
+	}
+
+	recognizer, err := NewCommandRecognizer("echo page:{}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := recognizer.Recognize(&rm.Rm{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(text, "page:") || !strings.HasSuffix(text, ".png") {
+		t.Errorf("image path not passed to the command: %s", text)
+	}
+}
+
+func TestRenderPage(t *testing.T) {
+	page := &rm.Rm{Layers: []rm.Layer{{Lines: []rm.Line{{
+		BrushType: rm.FinelinerV5,
+		Points:    []rm.Point{{X: 10, Y: 10, Width: 2}, {X: 100, Y: 10, Width: 2}},
+	}}}}}
+
+	img := RenderPage(page)
+	r, _, _, _ := img.At(50, 10).RGBA()
+	if r != 0 {
+		t.Error("stroke not rendered")
+	}
+	r, _, _, _ = img.At(50, 50).RGBA()
+	if r == 0 {
+		t.Error("background not white")
+	}
+}
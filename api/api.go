@@ -8,8 +8,11 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/juruen/rmapi/api/local"
 	"github.com/juruen/rmapi/api/sync10"
 	"github.com/juruen/rmapi/api/sync15"
+	"github.com/juruen/rmapi/api/usb"
+	"github.com/juruen/rmapi/config"
 	"github.com/juruen/rmapi/filetree"
 	"github.com/juruen/rmapi/model"
 	"github.com/juruen/rmapi/transport"
@@ -20,6 +23,7 @@ type ApiCtx interface {
 	FetchDocument(docId, dstPath string) error
 	CreateDir(parentId, name string, notify bool) (*model.Document, error)
 	UploadDocument(parentId string, sourceDocPath string, notify bool) (*model.Document, error)
+	ReplaceDocument(docId string, sourceZipPath string, notify bool) (*model.Document, error)
 	MoveEntry(src, dstDir *model.Node, name string) (*model.Node, error)
 	DeleteEntry(node *model.Node) error
 	SyncComplete() error
@@ -27,6 +31,75 @@ type ApiCtx interface {
 	Refresh() error
 }
 
+// BackupCtx is implemented by the backends that can back up and restore a whole account
+type BackupCtx interface {
+	Backup(dst string) (*sync15.Manifest, error)
+	Restore(src, targetId string, paths []string, dryRun bool) ([]*model.Document, error)
+}
+
+// WatchCtx is implemented by the backends that can tell what changed in the account
+type WatchCtx interface {
+	Changes() ([]sync15.Change, error)
+}
+
+// DiffCtx is implemented by the backends that can tell what changed since an earlier
+// generation of the account
+type DiffCtx interface {
+	Diff(pages bool) (*sync15.Diff, error)
+	DiffSinceGeneration(gen int64, pages bool) (*sync15.Diff, error)
+	DiffSinceTime(t time.Time, pages bool) (*sync15.Diff, error)
+}
+
+// UndoCtx is implemented by the backends that keep a journal of the operations and can revert them
+type UndoCtx interface {
+	Undo(n int) ([]sync15.JournalRecord, error)
+}
+
+// BatchCtx is implemented by the backends that can notify the tablets once after several operations
+type BatchCtx interface {
+	BeginBatch()
+	EndBatch() error
+}
+
+// HashCtx is implemented by the backends that know the hash of the content of a document,
+// which changes with any of its files
+type HashCtx interface {
+	DocumentHash(docId string) (string, error)
+}
+
+// ContentInfoCtx is implemented by the backends that read the file type and the number of pages
+// of the documents only when they're listed
+type ContentInfoCtx interface {
+	LoadContentInfo(nodes []*model.Node) error
+}
+
+// CopyEntry copies the entry src of the account srcCtx, and everything under it, into the directory
+// dstDir of the account dstCtx with the given name
+func CopyEntry(srcCtx ApiCtx, src *model.Node, dstCtx ApiCtx, dstDir *model.Node, name string) ([]*model.Document, error) {
+	if d, ok := srcCtx.(*DryRunCtx); ok {
+		srcCtx = d.ApiCtx
+	}
+	dryRun, isDryRun := dstCtx.(*DryRunCtx)
+	if isDryRun {
+		dstCtx = dryRun.ApiCtx
+	}
+
+	from, ok := srcCtx.(*sync15.ApiCtx)
+	to, ok2 := dstCtx.(*sync15.ApiCtx)
+	if !ok || !ok2 {
+		return nil, errors.New("copying documents needs the sync 1.5 API on both accounts")
+	}
+	if dstDir.IsFile() {
+		return nil, errors.New("destination directory is a file")
+	}
+
+	docs, err := to.CopyFrom(from, src, dstDir.Id(), name)
+	if isDryRun {
+		dryRun.report("copy "+src.Name()+" to "+name, err)
+	}
+	return docs, err
+}
+
 type UserToken struct {
 	Auth0 struct {
 		UserID string
@@ -39,12 +112,20 @@ type UserToken struct {
 type SyncVersion int
 
 const (
-	Version10 SyncVersion = 10
-	Version15 SyncVersion = 15
+	// VersionLocal is used for the documents of a local directory
+	VersionLocal SyncVersion = 0
+	// VersionUsb is used for the USB web interface of the tablet
+	VersionUsb SyncVersion = 1
+	Version10  SyncVersion = 10
+	Version15  SyncVersion = 15
 )
 
 func (s SyncVersion) String() string {
 	switch s {
+	case VersionLocal:
+		return "local"
+	case VersionUsb:
+		return "usb"
 	case Version10:
 		return "1.0"
 	case Version15:
@@ -57,46 +138,105 @@ func (s SyncVersion) String() string {
 type UserInfo struct {
 	SyncVersion SyncVersion
 	User        string
+	// Profile is the name of the account, empty for the default one
+	Profile string
 }
 
 func ParseToken(userToken string) (token *UserInfo, err error) {
-	claims := UserToken{}
-	_, _, err = (&jwt.Parser{}).ParseUnverified(userToken, &claims)
-
+	info, err := ParseTokenInfo(userToken)
 	if err != nil {
-		return nil, fmt.Errorf("can't parse token %v", err)
+		return nil, err
 	}
 
-	if !claims.VerifyExpiresAt(time.Now().Unix(), false) {
+	if info.Expired() {
 		return nil, errors.New("token Expired")
 	}
 
-	token = &UserInfo{
-		User:        claims.Auth0.Email,
-		SyncVersion: Version10,
+	return &info.UserInfo, nil
+}
+
+// TokenInfo describes a user token
+type TokenInfo struct {
+	UserInfo
+	Scopes []string
+	// ExpiresAt is zero when the token doesn't expire
+	ExpiresAt time.Time
+}
+
+// Expired tells whether the token has expired
+func (t *TokenInfo) Expired() bool {
+	return !t.ExpiresAt.IsZero() && t.ExpiresAt.Before(time.Now())
+}
+
+// ParseTokenInfo reads the claims of a user token, an expired token isn't an error
+func ParseTokenInfo(userToken string) (*TokenInfo, error) {
+	claims := UserToken{}
+	_, _, err := (&jwt.Parser{}).ParseUnverified(userToken, &claims)
+
+	if err != nil {
+		return nil, fmt.Errorf("can't parse token %v", err)
 	}
 
-	scopes := strings.Fields(claims.Scopes)
+	info := &TokenInfo{
+		UserInfo: UserInfo{
+			User:        claims.Auth0.Email,
+			SyncVersion: Version10,
+		},
+		Scopes: strings.Fields(claims.Scopes),
+	}
+	if claims.StandardClaims != nil && claims.ExpiresAt != 0 {
+		info.ExpiresAt = time.Unix(claims.ExpiresAt, 0)
+	}
 
-	for _, scope := range scopes {
+	for _, scope := range info.Scopes {
 		switch scope {
 		case "sync:fox", "sync:tortoise", "sync:hare":
-			token.SyncVersion = Version15
-			return
+			info.SyncVersion = Version15
 		}
 	}
-	return token, nil
+	return info, nil
 }
 
 // CreateApiCtx initializes an instance of ApiCtx
 func CreateApiCtx(httpCtx *transport.HttpClientCtx, syncVerison SyncVersion) (ctx ApiCtx, err error) {
+	return CreateProfileApiCtx(httpCtx, syncVerison, "")
+}
+
+// CreateProfileApiCtx initializes an instance of ApiCtx for the account named profile
+func CreateProfileApiCtx(httpCtx *transport.HttpClientCtx, syncVerison SyncVersion, profile string) (ctx ApiCtx, err error) {
 	switch syncVerison {
 	case Version10:
-		return sync10.CreateCtx(httpCtx)
+		urls, err := config.ProfileUrls(profile)
+		if err != nil {
+			return nil, err
+		}
+		return sync10.CreateCtx(httpCtx, urls)
 	case Version15:
-		return sync15.CreateCtx(httpCtx)
+		return sync15.CreateProfileCtx(httpCtx, profile)
 	default:
 		log.Fatal("Unsupported sync version")
 	}
 	return
 }
+
+// CreateLocalApiCtx initializes an instance of ApiCtx on a local copy
+// of the documents of the tablet found in dir
+func CreateLocalApiCtx(dir string) (ApiCtx, *UserInfo, error) {
+	ctx, err := local.CreateCtx(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ctx, &UserInfo{SyncVersion: VersionLocal, User: dir}, nil
+}
+
+// CreateUsbApiCtx initializes an instance of ApiCtx on the USB web interface
+// of the tablet found at host
+func CreateUsbApiCtx(host string) (ApiCtx, *UserInfo, error) {
+	ctx, err := usb.CreateCtx(host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ctx, &UserInfo{SyncVersion: VersionUsb, User: host}, nil
+}
@@ -2,11 +2,13 @@ package api
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/juruen/rmapi/auth"
 	"github.com/juruen/rmapi/config"
 	"github.com/juruen/rmapi/log"
 	"github.com/juruen/rmapi/model"
@@ -15,24 +17,38 @@ import (
 
 const (
 	defaultDeviceDesc string = "desktop-linux"
+	authRetries              = 3
 )
 
 func AuthHttpCtx(reAuth, nonInteractive bool) *transport.HttpClientCtx {
-	configPath, err := config.ConfigPath()
+	return ProfileAuthHttpCtx("", reAuth, nonInteractive)
+}
+
+// ProfileAuthHttpCtx authenticates the account named profile, an empty profile is the default account
+func ProfileAuthHttpCtx(profile string, reAuth, nonInteractive bool) *transport.HttpClientCtx {
+	urls, err := config.ProfileUrls(profile)
+	if err != nil {
+		log.Error.Fatal("failed to read the config: ", err)
+	}
+	store, err := ProfileTokenStore(profile, nonInteractive)
+	if err != nil {
+		log.Error.Fatal("failed to open the token store: ", err)
+	}
+	tokens, err := store.Load()
 	if err != nil {
-		log.Error.Fatal("failed to get config path")
+		log.Error.Fatal("failed to read tokens: ", err)
 	}
-	authTokens := config.LoadTokens(configPath)
+	authTokens := model.AuthTokens{DeviceToken: tokens.DeviceToken, UserToken: tokens.UserToken}
 	httpClientCtx := transport.CreateHttpClientCtx(authTokens)
 
 	if authTokens.DeviceToken == "" {
 		if nonInteractive {
 			log.Error.Fatal("missing token, not asking, aborting")
 		}
-		deviceToken, err := newDeviceToken(&httpClientCtx, readCode())
+		deviceToken, err := newDeviceToken(&httpClientCtx, urls, readCode())
 
 		if err != nil {
-			log.Error.Fatal("failed to crete device token from on-time code")
+			log.Error.Fatal(err)
 		}
 
 		log.Trace.Println("device token", deviceToken)
@@ -40,11 +56,11 @@ func AuthHttpCtx(reAuth, nonInteractive bool) *transport.HttpClientCtx {
 		authTokens.DeviceToken = deviceToken
 		httpClientCtx.Tokens.DeviceToken = deviceToken
 
-		config.SaveTokens(configPath, authTokens)
+		saveTokens(store, authTokens)
 	}
 
 	if authTokens.UserToken == "" || reAuth {
-		userToken, err := newUserToken(&httpClientCtx)
+		userToken, err := newUserToken(&httpClientCtx, urls)
 
 		if err == transport.ErrUnauthorized {
 			log.Trace.Println("Invalid deviceToken, resetting")
@@ -58,12 +74,174 @@ func AuthHttpCtx(reAuth, nonInteractive bool) *transport.HttpClientCtx {
 		authTokens.UserToken = userToken
 		httpClientCtx.Tokens.UserToken = userToken
 
-		config.SaveTokens(configPath, authTokens)
+		saveTokens(store, authTokens)
 	}
 
+	// long sessions outlive the user token, the client renews it on the way
+	httpClientCtx.SetTokenRenewal(func() (string, error) {
+		return newUserToken(&httpClientCtx, urls)
+	}, func(tokens model.AuthTokens) {
+		saveTokens(store, tokens)
+	})
+
 	return &httpClientCtx
 }
 
+// CreateCloudApiCtx authenticates the account named profile against the cloud
+// and builds its document tree
+func CreateCloudApiCtx(profile string, nonInteractive bool) (ctx ApiCtx, userInfo *UserInfo, err error) {
+	for i := 0; i < authRetries; i++ {
+		authCtx := ProfileAuthHttpCtx(profile, i > 0, nonInteractive)
+
+		userInfo, err = ParseToken(authCtx.Tokens.UserToken)
+		if err != nil {
+			log.Trace.Println(err)
+			continue
+		}
+		userInfo.Profile = profile
+
+		ctx, err = CreateProfileApiCtx(authCtx, userInfo.SyncVersion, profile)
+		if err != nil {
+			log.Trace.Println(err)
+		} else {
+			break
+		}
+	}
+
+	return
+}
+
+// ProfileLoggedIn tells whether the account named profile has a device token
+func ProfileLoggedIn(profile string) bool {
+	store, err := ProfileTokenStore(profile, true)
+	if err != nil {
+		return false
+	}
+
+	tokens, err := store.Load()
+	return err == nil && tokens.DeviceToken != ""
+}
+
+// Login registers a new device for the account named profile with the one-time code
+// and stores its tokens. An empty code is asked for.
+func Login(profile, code string, nonInteractive bool) (*TokenInfo, error) {
+	if code == "" {
+		if nonInteractive {
+			return nil, errors.New("missing one-time code, not asking")
+		}
+		code = readCode()
+	}
+	if len(code) != 8 {
+		return nil, errors.New("the one-time code should have 8 characters")
+	}
+
+	urls, err := config.ProfileUrls(profile)
+	if err != nil {
+		return nil, err
+	}
+	store, err := ProfileTokenStore(profile, nonInteractive)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClientCtx := transport.CreateHttpClientCtx(model.AuthTokens{})
+	deviceToken, err := newDeviceToken(&httpClientCtx, urls, code)
+	if err != nil {
+		return nil, err
+	}
+	httpClientCtx.Tokens.DeviceToken = deviceToken
+
+	// the device is registered even if the user token fails, keep it
+	userToken, tokenErr := newUserToken(&httpClientCtx, urls)
+	if err = store.Save(auth.TokenSet{DeviceToken: deviceToken, UserToken: userToken}); err != nil {
+		return nil, err
+	}
+	if tokenErr != nil {
+		return nil, fmt.Errorf("failed to create a user token: %v", tokenErr)
+	}
+
+	return ParseTokenInfo(userToken)
+}
+
+// RefreshToken renews the user token of the account named profile with its device token
+func RefreshToken(profile string, nonInteractive bool) (*TokenInfo, error) {
+	urls, err := config.ProfileUrls(profile)
+	if err != nil {
+		return nil, err
+	}
+	store, err := ProfileTokenStore(profile, nonInteractive)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if tokens.DeviceToken == "" {
+		return nil, errors.New("not logged in")
+	}
+
+	httpClientCtx := transport.CreateHttpClientCtx(model.AuthTokens{DeviceToken: tokens.DeviceToken})
+	tokens.UserToken, err = newUserToken(&httpClientCtx, urls)
+	if err == transport.ErrUnauthorized {
+		return nil, errors.New("the device token was rejected, log in again")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = store.Save(tokens); err != nil {
+		return nil, err
+	}
+
+	return ParseTokenInfo(tokens.UserToken)
+}
+
+// Logout removes the tokens of the account named profile.
+// The cloud has no endpoint to unregister a device, it's removed from the account
+// on https://my.remarkable.com
+func Logout(profile string, nonInteractive bool) error {
+	store, err := ProfileTokenStore(profile, nonInteractive)
+	if err != nil {
+		return err
+	}
+
+	return auth.Reset(store)
+}
+
+// ProfileTokenStore returns the store of the tokens of the account named profile
+// as set in the config file
+func ProfileTokenStore(profile string, nonInteractive bool) (auth.TokenStore, error) {
+	settings, err := config.Settings(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.NewProfileTokenStore(profile, settings.TokenStore, func() (string, error) {
+		if passphrase := os.Getenv(auth.PassphraseEnvVar); passphrase != "" {
+			return passphrase, nil
+		}
+		if nonInteractive {
+			return "", fmt.Errorf("missing passphrase of the tokens, set %s", auth.PassphraseEnvVar)
+		}
+		return readPassphrase(), nil
+	})
+}
+
+func saveTokens(store auth.TokenStore, tokens model.AuthTokens) {
+	if err := store.Save(auth.TokenSet{DeviceToken: tokens.DeviceToken, UserToken: tokens.UserToken}); err != nil {
+		log.Warning.Println("failed to save tokens", err)
+	}
+}
+
+func readPassphrase() string {
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Print("Enter the passphrase of the tokens: ")
+	passphrase, _ := reader.ReadString('\n')
+
+	return strings.TrimRight(passphrase, "\r\n")
+}
+
 func readCode() string {
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Print("Enter one-time code (go to https://my.remarkable.com/device/desktop/connect): ")
@@ -80,25 +258,24 @@ func readCode() string {
 	return code
 }
 
-func newDeviceToken(http *transport.HttpClientCtx, code string) (string, error) {
+func newDeviceToken(http *transport.HttpClientCtx, urls config.Urls, code string) (string, error) {
 	uuid := uuid.New()
 
 	req := model.DeviceTokenRequest{code, defaultDeviceDesc, uuid.String()}
 
 	resp := transport.BodyString{}
-	err := http.Post(transport.EmptyBearer, config.NewTokenDevice, req, &resp)
+	err := http.Post(transport.EmptyBearer, urls.NewTokenDevice, req, &resp)
 
 	if err != nil {
-		log.Error.Fatal("failed to create a new device token")
-		return "", err
+		return "", fmt.Errorf("failed to create a new device token: %v", err)
 	}
 
 	return resp.Content, nil
 }
 
-func newUserToken(http *transport.HttpClientCtx) (string, error) {
+func newUserToken(http *transport.HttpClientCtx, urls config.Urls) (string, error) {
 	resp := transport.BodyString{}
-	err := http.Post(transport.DeviceBearer, config.NewUserDevice, nil, &resp)
+	err := http.Post(transport.DeviceBearer, urls.NewUserDevice, nil, &resp)
 
 	if err != nil {
 		return "", err
@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/juruen/rmapi/config"
 	"github.com/juruen/rmapi/transport"
 )
 
@@ -47,6 +48,7 @@ func Test_readCode(t *testing.T) {
 func Test_newDeviceToken(t *testing.T) {
 	type args struct {
 		http *transport.HttpClientCtx
+		urls config.Urls
 		code string
 	}
 	tests := []struct {
@@ -59,7 +61,7 @@ func Test_newDeviceToken(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := newDeviceToken(tt.args.http, tt.args.code)
+			got, err := newDeviceToken(tt.args.http, tt.args.urls, tt.args.code)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("newDeviceToken() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -74,6 +76,7 @@ func Test_newDeviceToken(t *testing.T) {
 func Test_newUserToken(t *testing.T) {
 	type args struct {
 		http *transport.HttpClientCtx
+		urls config.Urls
 	}
 	tests := []struct {
 		name    string
@@ -85,7 +88,7 @@ func Test_newUserToken(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := newUserToken(tt.args.http)
+			got, err := newUserToken(tt.args.http, tt.args.urls)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("newUserToken() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -96,3 +99,23 @@ func Test_newUserToken(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTokenInfo(t *testing.T) {
+	// {"exp":1900000000,"scopes":"sync:tortoise intgr","auth0-profile":{"Email":"a@b.c"}}
+	token := "eyJhbGciOiJIUzI1NiJ9.eyJleHAiOjE5MDAwMDAwMDAsInNjb3BlcyI6InN5bmM6dG9ydG9pc2UgaW50Z3IiLCJhdXRoMC1wcm9maWxlIjp7IkVtYWlsIjoiYUBiLmMifX0.x"
+
+	info, err := ParseTokenInfo(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.User != "a@b.c" || info.SyncVersion != Version15 || info.ExpiresAt.Unix() != 1900000000 {
+		t.Errorf("ParseTokenInfo() = %+v", info)
+	}
+	if info.Expired() {
+		t.Error("token shouldn't be expired")
+	}
+
+	if _, err = ParseTokenInfo("garbage"); err == nil {
+		t.Error("ParseTokenInfo() should fail")
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/juruen/rmapi/api/sync15"
+	"github.com/juruen/rmapi/model"
+)
+
+// DryRunCtx runs the operations that change the account against a copy of its tree
+// and prints what they would change, without uploading anything
+type DryRunCtx struct {
+	*sync15.ApiCtx
+	out io.Writer
+}
+
+// NewDryRunCtx wraps ctx so that its operations are only simulated, their plans are printed to out
+func NewDryRunCtx(ctx ApiCtx, out io.Writer) (*DryRunCtx, error) {
+	c, ok := ctx.(*sync15.ApiCtx)
+	if !ok {
+		return nil, errors.New("dry-run is only supported with the sync 1.5 API")
+	}
+	return &DryRunCtx{ApiCtx: c.DryRun(), out: out}, nil
+}
+
+// DryRun wraps another account so that it's only simulated as well
+func (ctx *DryRunCtx) DryRun(other ApiCtx) (*DryRunCtx, error) {
+	return NewDryRunCtx(other, ctx.out)
+}
+
+func (ctx *DryRunCtx) CreateDir(parentId, name string, notify bool) (*model.Document, error) {
+	doc, err := ctx.ApiCtx.CreateDir(parentId, name, notify)
+	ctx.report("create directory "+name, err)
+	return doc, err
+}
+
+func (ctx *DryRunCtx) UploadDocument(parentId string, sourceDocPath string, notify bool) (*model.Document, error) {
+	doc, err := ctx.ApiCtx.UploadDocument(parentId, sourceDocPath, notify)
+	ctx.report("upload "+sourceDocPath, err)
+	return doc, err
+}
+
+func (ctx *DryRunCtx) ReplaceDocument(docId string, sourceZipPath string, notify bool) (*model.Document, error) {
+	doc, err := ctx.ApiCtx.ReplaceDocument(docId, sourceZipPath, notify)
+	ctx.report("replace "+docId+" with "+sourceZipPath, err)
+	return doc, err
+}
+
+func (ctx *DryRunCtx) MoveEntry(src, dstDir *model.Node, name string) (*model.Node, error) {
+	node, err := ctx.ApiCtx.MoveEntry(src, dstDir, name)
+	ctx.report("move "+src.Name()+" to "+name, err)
+	return node, err
+}
+
+func (ctx *DryRunCtx) DeleteEntry(node *model.Node) error {
+	err := ctx.ApiCtx.DeleteEntry(node)
+	ctx.report("delete "+node.Name(), err)
+	return err
+}
+
+func (ctx *DryRunCtx) Nuke() error {
+	err := ctx.ApiCtx.Nuke()
+	ctx.report("delete everything", err)
+	return err
+}
+
+func (ctx *DryRunCtx) Restore(src, targetId string, paths []string, dryRun bool) ([]*model.Document, error) {
+	docs, err := ctx.ApiCtx.Restore(src, targetId, paths, dryRun)
+	ctx.report("restore "+src, err)
+	return docs, err
+}
+
+func (ctx *DryRunCtx) Undo(n int) ([]sync15.JournalRecord, error) {
+	records, err := ctx.ApiCtx.Undo(n)
+	// the plan covers all the operations undone
+	ctx.report(fmt.Sprintf("undo %d operations", len(records)), nil)
+	return records, err
+}
+
+// report prints the plan of the last operation
+func (ctx *DryRunCtx) report(operation string, err error) {
+	plan := ctx.TakePlan()
+	if err != nil || plan == nil {
+		return
+	}
+
+	fmt.Fprintf(ctx.out, "dry-run: %s\n", operation)
+	for _, c := range plan.Changes {
+		if c.OldPath != "" {
+			fmt.Fprintf(ctx.out, "  %-9s%s -> %s\n", c.Type, c.OldPath, c.Path)
+		} else {
+			fmt.Fprintf(ctx.out, "  %-9s%s\n", c.Type, c.Path)
+		}
+	}
+	var size int64
+	for _, b := range plan.Blobs {
+		size += b.Size
+		fmt.Fprintf(ctx.out, "  upload   %s (%d bytes)\n", b.Hash, b.Size)
+	}
+	fmt.Fprintf(ctx.out, "  %d blobs, %d bytes to upload\n", len(plan.Blobs), size)
+	fmt.Fprintf(ctx.out, "  new root %s (generation %d)\n", plan.RootHash, plan.Generation)
+}
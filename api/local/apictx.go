@@ -0,0 +1,422 @@
+// Package local implements the API on a directory laid out like the
+// ~/.local/share/remarkable/xochitl directory of the tablet,
+// e.g. a backup or an rsync'd copy of the device.
+package local
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/juruen/rmapi/archive"
+	"github.com/juruen/rmapi/convert"
+	"github.com/juruen/rmapi/filetree"
+	"github.com/juruen/rmapi/log"
+	"github.com/juruen/rmapi/model"
+	"github.com/juruen/rmapi/util"
+)
+
+// An ApiCtx allows you to interact with a local copy of the documents of the tablet
+type ApiCtx struct {
+	dir string
+	ft  *filetree.FileTreeCtx
+}
+
+// CreateCtx reads the documents found in dir
+func CreateCtx(dir string) (*ApiCtx, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	ctx := &ApiCtx{dir: dir}
+	if err = ctx.Refresh(); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+func (ctx *ApiCtx) Filetree() *filetree.FileTreeCtx {
+	return ctx.ft
+}
+
+// Refresh reads the documents of the directory again
+func (ctx *ApiCtx) Refresh() error {
+	tree, err := DocumentsFileTree(ctx.dir)
+	if err != nil {
+		return err
+	}
+	ctx.ft = tree
+	return nil
+}
+
+// Nuke is not supported to avoid wiping out a backup by mistake
+func (ctx *ApiCtx) Nuke() error {
+	return errors.New("not supported on a local directory")
+}
+
+// FetchDocument zips the files of a document into dstPath
+func (ctx *ApiCtx) FetchDocument(docId, dstPath string) error {
+	files, err := ctx.documentFiles(docId)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "rmapizip")
+	if err != nil {
+		log.Error.Println("failed to create tmpfile for zip dir", err)
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := zip.NewWriter(tmp)
+	for _, name := range files {
+		log.Trace.Println("fetching document: ", name)
+		header := zip.FileHeader{Name: name, Modified: time.Now()}
+		zipWriter, err := w.CreateHeader(&header)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(filepath.Join(ctx.dir, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(zipWriter, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	_, err = util.CopyFile(tmp.Name(), dstPath)
+	if err != nil {
+		log.Error.Printf("failed to copy %s to %s, er: %s\n", tmp.Name(), dstPath, err.Error())
+	}
+	return err
+}
+
+// CreateDir creates a directory with a given name under the parentId directory
+func (ctx *ApiCtx) CreateDir(parentId, name string, notify bool) (*model.Document, error) {
+	id := uuid.New().String()
+
+	_, metadataPath, err := archive.CreateMetadata(id, name, parentId, model.DirectoryType, ctx.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err = archive.CreateContent(id, "", ctx.dir, nil); err != nil {
+		return nil, err
+	}
+
+	meta, err := readMetadata(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return meta.ToDocument(id), nil
+}
+
+// UploadDocument copies a local document given by sourceDocPath under the parentId directory
+func (ctx *ApiCtx) UploadDocument(parentId string, sourceDocPath string, notify bool) (*model.Document, error) {
+	name, ext := util.DocPathToName(sourceDocPath)
+
+	if name == "" {
+		return nil, errors.New("file name is invalid")
+	}
+
+	if !util.IsFileTypeSupported(ext) {
+		return nil, errors.New("unsupported file extension: " + ext)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "rmupload")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	sourceDocPath, ext, err = convert.Prepare(sourceDocPath, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	docFiles, id, err := archive.Prepare(name, parentId, sourceDocPath, ext, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = os.Stat(ctx.metadataPath(id)); err == nil {
+		return nil, errors.New("a document with the same id already exists")
+	}
+
+	if err = ctx.copyFiles(docFiles); err != nil {
+		return nil, err
+	}
+
+	meta, err := readMetadata(ctx.metadataPath(id))
+	if err != nil {
+		return nil, err
+	}
+
+	return meta.ToDocument(id), nil
+}
+
+// ReplaceDocument replaces the files of the document docId with the ones of the archive sourceZipPath
+// keeping its metadata
+func (ctx *ApiCtx) ReplaceDocument(docId string, sourceZipPath string, notify bool) (*model.Document, error) {
+	tmpDir, err := os.MkdirTemp("", "rmupload")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	id, docFiles, _, err := archive.Unpack(sourceZipPath, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	if id != docId {
+		return nil, errors.New("the archive belongs to a different document")
+	}
+
+	meta, err := readMetadata(ctx.metadataPath(docId))
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := ctx.documentFiles(docId)
+	if err != nil {
+		return nil, err
+	}
+
+	files := &archive.DocumentFiles{}
+	replaced := make(map[string]bool)
+	for _, f := range docFiles.Files {
+		if strings.HasSuffix(f.Name, ".metadata") {
+			continue
+		}
+		files.AddMap(f.Name, f.Path)
+		replaced[f.Name] = true
+	}
+
+	for _, name := range current {
+		if !replaced[name] && !strings.HasSuffix(name, ".metadata") {
+			if err = os.Remove(filepath.Join(ctx.dir, filepath.FromSlash(name))); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err = ctx.copyFiles(files); err != nil {
+		return nil, err
+	}
+
+	meta.Version += 1
+	meta.LastModified = archive.UnixTimestamp()
+	meta.Modified = true
+	meta.MetadataModified = true
+	if err = writeMetadata(ctx.metadataPath(docId), meta); err != nil {
+		return nil, err
+	}
+
+	return meta.ToDocument(docId), nil
+}
+
+// MoveEntry moves an entry (either a directory or a file)
+// - src is the source node to be moved
+// - dstDir is an existing destination directory
+// - name is the new name of the moved entry in the destination directory
+func (ctx *ApiCtx) MoveEntry(src, dstDir *model.Node, name string) (*model.Node, error) {
+	if dstDir.IsFile() {
+		return nil, errors.New("destination directory is a file")
+	}
+
+	metadataPath := ctx.metadataPath(src.Document.ID)
+	meta, err := readMetadata(metadataPath)
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Version += 1
+	meta.DocName = name
+	meta.Parent = dstDir.Id()
+	meta.LastModified = archive.UnixTimestamp()
+	meta.MetadataModified = true
+
+	if err = writeMetadata(metadataPath, meta); err != nil {
+		return nil, err
+	}
+
+	return &model.Node{Document: meta.ToDocument(src.Document.ID), Children: src.Children, Parent: dstDir}, nil
+}
+
+// DeleteEntry removes an entry: either an empty directory or a file
+func (ctx *ApiCtx) DeleteEntry(node *model.Node) error {
+	if node.IsDirectory() && len(node.Children) > 0 {
+		return errors.New("directory is not empty")
+	}
+
+	files, err := ctx.documentFiles(node.Document.ID)
+	if err != nil {
+		return err
+	}
+
+	// remove the metadata last, so an interrupted removal still shows the entry
+	for _, name := range files {
+		if strings.HasSuffix(name, ".metadata") {
+			continue
+		}
+		if err = os.Remove(filepath.Join(ctx.dir, filepath.FromSlash(name))); err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range []string{node.Document.ID, node.Document.ID + ".thumbnails", node.Document.ID + ".highlights", node.Document.ID + ".textconversion"} {
+		os.Remove(filepath.Join(ctx.dir, dir))
+	}
+
+	return os.Remove(ctx.metadataPath(node.Document.ID))
+}
+
+// SyncComplete does nothing for a local directory
+func (ctx *ApiCtx) SyncComplete() error {
+	return nil
+}
+
+// DocumentsFileTree reads the metadata of the documents in dir and builds a file tree
+// structure to represent them
+func DocumentsFileTree(dir string) (*filetree.FileTreeCtx, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	fileTree := filetree.CreateFileTreeCtx()
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || filepath.Ext(name) != ".metadata" {
+			continue
+		}
+
+		id := strings.TrimSuffix(name, ".metadata")
+		meta, err := readMetadata(filepath.Join(dir, name))
+		if err != nil {
+			log.Warning.Printf("skipping %s: %v", name, err)
+			continue
+		}
+
+		if meta.Deleted {
+			continue
+		}
+
+		fileTree.AddDocument(meta.ToDocument(id))
+	}
+
+	for _, d := range fileTree.Root().Children {
+		log.Trace.Println(d.Name(), d.IsFile())
+	}
+
+	return &fileTree, nil
+}
+
+// documentFiles lists the files of a document relative to the directory
+// using slashes as separators, like the names in an archive
+func (ctx *ApiCtx) documentFiles(docId string) ([]string, error) {
+	if _, err := os.Stat(ctx.metadataPath(docId)); err != nil {
+		return nil, fmt.Errorf("document %s not found", docId)
+	}
+
+	entries, err := os.ReadDir(ctx.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0)
+	for _, e := range entries {
+		name := e.Name()
+		if name != docId && !strings.HasPrefix(name, docId+".") {
+			continue
+		}
+
+		if !e.IsDir() {
+			files = append(files, name)
+			continue
+		}
+
+		err = filepath.WalkDir(filepath.Join(ctx.dir, name), func(p string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(ctx.dir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// copyFiles copies the prepared files of a document into the directory
+func (ctx *ApiCtx) copyFiles(files *archive.DocumentFiles) error {
+	for _, f := range files.Files {
+		log.Info.Printf("File %s, path: %s", f.Name, f.Path)
+		dst := filepath.Join(ctx.dir, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return err
+		}
+		if _, err := util.CopyFile(f.Path, dst); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ctx *ApiCtx) metadataPath(id string) string {
+	return filepath.Join(ctx.dir, id+".metadata")
+}
+
+func readMetadata(path string) (*archive.MetadataFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &archive.MetadataFile{}
+	if err = json.Unmarshal(data, meta); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+func writeMetadata(path string, meta *archive.MetadataFile) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,97 @@
+package local
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/juruen/rmapi/archive"
+	"github.com/juruen/rmapi/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	ctx, err := CreateCtx(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	folder, err := ctx.CreateDir("", "Books", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.Filetree().AddDocument(folder)
+
+	src := filepath.Join(t.TempDir(), "book.pdf")
+	if _, err = util.CopyFile("../../archive/zipdoc_test.pdf", src); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := ctx.UploadDocument(folder.ID, src, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "book", doc.VissibleName)
+
+	// a new context reads what was written
+	ctx, err = CreateCtx(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := ctx.Filetree().NodeByPath("/Books/book", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, doc.ID, node.Document.ID)
+
+	moved, err := ctx.MoveEntry(node, ctx.Filetree().Root(), "renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "", moved.Document.Parent)
+	assert.Equal(t, 1, moved.Document.Version)
+
+	zipPath := filepath.Join(t.TempDir(), "book.zip")
+	if err = ctx.FetchDocument(doc.ID, zipPath); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	r.Close()
+	sort.Strings(names)
+	assert.Equal(t, []string{doc.ID + ".content", doc.ID + ".metadata", doc.ID + ".pdf"}, names)
+
+	replaced, err := ctx.ReplaceDocument(doc.ID, zipPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "renamed", replaced.VissibleName)
+	assert.Equal(t, 2, replaced.Version)
+
+	if err = ctx.DeleteEntry(moved); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(dir)
+	assert.Equal(t, 2, len(entries), "only the folder should be left")
+}
+
+func TestDeletedDocumentsAreHidden(t *testing.T) {
+	dir := t.TempDir()
+	writeMetadata(filepath.Join(dir, "gone.metadata"), &archive.MetadataFile{DocName: "gone", Deleted: true})
+
+	ctx, err := CreateCtx(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, len(ctx.Filetree().Root().Children))
+}
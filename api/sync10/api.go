@@ -9,6 +9,7 @@ import (
 
 	"github.com/juruen/rmapi/archive"
 	"github.com/juruen/rmapi/config"
+	"github.com/juruen/rmapi/convert"
 	"github.com/juruen/rmapi/filetree"
 	"github.com/juruen/rmapi/log"
 	"github.com/juruen/rmapi/model"
@@ -20,6 +21,8 @@ import (
 type ApiCtx struct {
 	Http *transport.HttpClientCtx
 	ft   *filetree.FileTreeCtx
+	// urls are the endpoints of the account
+	urls config.Urls
 }
 
 func (ctx *ApiCtx) Filetree() *filetree.FileTreeCtx {
@@ -34,14 +37,14 @@ func (ctx *ApiCtx) Refresh() (err error) {
 func (ctx *ApiCtx) Nuke() error {
 	documents := make([]model.Document, 0)
 
-	if err := ctx.Http.Get(transport.UserBearer, config.ListDocs, nil, &documents); err != nil {
+	if err := ctx.Http.Get(transport.UserBearer, ctx.urls.ListDocs, nil, &documents); err != nil {
 		return err
 	}
 
 	for _, d := range documents {
 		log.Info.Println("Deleting: ", d.VissibleName)
 
-		err := ctx.Http.Put(transport.UserBearer, config.DeleteEntry, util.InSlice(d), nil)
+		err := ctx.Http.Put(transport.UserBearer, ctx.urls.DeleteEntry, util.InSlice(d), nil)
 		if err != nil {
 			log.Error.Println("failed to remove entry", err)
 			return err
@@ -55,7 +58,7 @@ func (ctx *ApiCtx) Nuke() error {
 func (ctx *ApiCtx) FetchDocument(docId, dstPath string) error {
 	documents := make([]model.Document, 0)
 
-	url := fmt.Sprintf("%s?withBlob=true&doc=%s", config.ListDocs, docId)
+	url := fmt.Sprintf("%s?withBlob=true&doc=%s", ctx.urls.ListDocs, docId)
 
 	if err := ctx.Http.Get(transport.UserBearer, url, nil, &documents); err != nil {
 		log.Error.Println("failed to fetch document BlobURLGet", err)
@@ -145,7 +148,7 @@ func (ctx *ApiCtx) CreateDir(parentId, name string, notify bool) (*model.Documen
 
 	metaDoc := model.CreateUploadDocumentMeta(uploadRsp.ID, model.DirectoryType, parentId, name)
 
-	err = ctx.Http.Put(transport.UserBearer, config.UpdateStatus, util.InSlice(metaDoc), nil)
+	err = ctx.Http.Put(transport.UserBearer, ctx.urls.UpdateStatus, util.InSlice(metaDoc), nil)
 
 	if err != nil {
 		log.Error.Println("failed to move entry", err)
@@ -166,7 +169,7 @@ func (ctx *ApiCtx) DeleteEntry(node *model.Node) error {
 
 	deleteDoc := node.Document.ToDeleteDocument()
 
-	err := ctx.Http.Put(transport.UserBearer, config.DeleteEntry, util.InSlice(deleteDoc), nil)
+	err := ctx.Http.Put(transport.UserBearer, ctx.urls.DeleteEntry, util.InSlice(deleteDoc), nil)
 
 	if err != nil {
 		log.Error.Println("failed to remove entry", err)
@@ -190,7 +193,7 @@ func (ctx *ApiCtx) MoveEntry(src, dstDir *model.Node, name string) (*model.Node,
 	metaDoc.VissibleName = name
 	metaDoc.Parent = dstDir.Id()
 
-	err := ctx.Http.Put(transport.UserBearer, config.UpdateStatus, util.InSlice(metaDoc), nil)
+	err := ctx.Http.Put(transport.UserBearer, ctx.urls.UpdateStatus, util.InSlice(metaDoc), nil)
 
 	if err != nil {
 		log.Error.Println("failed to move entry", err)
@@ -214,8 +217,19 @@ func (ctx *ApiCtx) UploadDocument(parentId string, sourceDocPath string, notify
 		return nil, errors.New("unsupported file extension: " + ext)
 	}
 
+	tmpDir, err := ioutil.TempDir("", "rmupload")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	sourceDocPath, ext, err = convert.Prepare(sourceDocPath, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
 	id := ""
-	var err error
 
 	//restore document
 	if ext == "zip" {
@@ -262,7 +276,7 @@ func (ctx *ApiCtx) UploadDocument(parentId string, sourceDocPath string, notify
 
 	metaDoc := model.CreateUploadDocumentMeta(uploadRsp.ID, model.DocumentType, parentId, name)
 
-	err = ctx.Http.Put(transport.UserBearer, config.UpdateStatus, util.InSlice(metaDoc), nil)
+	err = ctx.Http.Put(transport.UserBearer, ctx.urls.UpdateStatus, util.InSlice(metaDoc), nil)
 
 	if err != nil {
 		log.Error.Println("failed to move entry", err)
@@ -274,11 +288,16 @@ func (ctx *ApiCtx) UploadDocument(parentId string, sourceDocPath string, notify
 	return &doc, err
 }
 
+// ReplaceDocument is not supported by this version
+func (ctx *ApiCtx) ReplaceDocument(docId string, sourceZipPath string, notify bool) (*model.Document, error) {
+	return nil, errors.New("not implemented")
+}
+
 func (ctx *ApiCtx) uploadRequest(id string, entryType string) (model.UploadDocumentResponse, error) {
 	uploadReq := model.CreateUploadDocumentRequest(id, entryType)
 	uploadRsp := make([]model.UploadDocumentResponse, 0)
 
-	err := ctx.Http.Put(transport.UserBearer, config.UploadRequest, util.InSlice(uploadReq), &uploadRsp)
+	err := ctx.Http.Put(transport.UserBearer, ctx.urls.UploadRequest, util.InSlice(uploadReq), &uploadRsp)
 
 	if err != nil {
 		log.Error.Println("failed to to send upload request", err)
@@ -288,21 +307,21 @@ func (ctx *ApiCtx) uploadRequest(id string, entryType string) (model.UploadDocum
 	return uploadRsp[0], nil
 }
 
-func CreateCtx(http *transport.HttpClientCtx) (*ApiCtx, error) {
+func CreateCtx(http *transport.HttpClientCtx, urls config.Urls) (*ApiCtx, error) {
 
-	tree, err := DocumentsFileTree(http)
+	tree, err := DocumentsFileTree(http, urls)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch document tree %v", err)
 	}
-	return &ApiCtx{http, tree}, nil
+	return &ApiCtx{http, tree, urls}, nil
 }
 
 // DocumentsFileTree reads your remote documents and builds a file tree
 // structure to represent them
-func DocumentsFileTree(http *transport.HttpClientCtx) (*filetree.FileTreeCtx, error) {
+func DocumentsFileTree(http *transport.HttpClientCtx, urls config.Urls) (*filetree.FileTreeCtx, error) {
 	documents := make([]*model.Document, 0)
 
-	if err := http.Get(transport.UserBearer, config.ListDocs, nil, &documents); err != nil {
+	if err := http.Get(transport.UserBearer, urls.ListDocs, nil, &documents); err != nil {
 		return nil, err
 	}
 
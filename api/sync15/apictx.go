@@ -7,11 +7,13 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/juruen/rmapi/archive"
+	"github.com/juruen/rmapi/config"
+	"github.com/juruen/rmapi/convert"
 	"github.com/juruen/rmapi/filetree"
 	"github.com/juruen/rmapi/log"
 	"github.com/juruen/rmapi/model"
@@ -23,34 +25,45 @@ import (
 type ApiCtx struct {
 	Http        *transport.HttpClientCtx
 	ft          *filetree.FileTreeCtx
-	blobStorage *BlobStorage
+	blobStorage BlobStore
 	hashTree    *HashTree
+	// session is the cached tree as it was before the account was mirrored
+	// at the start of the session
+	session *HashTree
+	// batch is the depth of the nested batches, the tablets are notified once
+	// at the end of the outermost one when syncPending
+	batch       int
+	syncPending bool
+	// concurrent is the max number of concurrent requests, set from the profile of the account
+	concurrent int
 }
 
-// max number of concurrent requests
-var concurrent = 20
+func CreateCtx(http *transport.HttpClientCtx) (*ApiCtx, error) {
+	return CreateProfileCtx(http, "")
+}
 
-func init() {
-	c := os.Getenv("RMAPI_CONCURRENT")
-	if u, err := strconv.Atoi(c); err == nil {
-		concurrent = u
+// CreateProfileCtx creates the context of the account named profile, which has its own cached tree
+func CreateProfileCtx(http *transport.HttpClientCtx, profile string) (*ApiCtx, error) {
+	settings, err := config.Settings(profile)
+	if err != nil {
+		return nil, err
 	}
-}
+	concurrent := settings.Concurrent
 
-func CreateCtx(http *transport.HttpClientCtx) (*ApiCtx, error) {
-	apiStorage := NewBlobStorage(http)
-	cacheTree, err := loadTree()
+	apiStorage := NewBlobStorage(http, settings.Urls())
+	cacheTree, err := loadTree(profile)
 	if err != nil {
 		fmt.Print(err)
 		return nil, err
 	}
+	session := cacheTree.Clone()
 	err = cacheTree.Mirror(apiStorage, concurrent)
 	if err != nil {
 		return nil, err
 	}
 	saveTree(cacheTree)
 	tree := DocumentsFileTree(cacheTree)
-	return &ApiCtx{http, tree, apiStorage, cacheTree}, nil
+	return &ApiCtx{Http: http, ft: tree, blobStorage: apiStorage, hashTree: cacheTree, session: session, concurrent: concurrent}, nil
 }
 
 func (ctx *ApiCtx) Filetree() *filetree.FileTreeCtx {
@@ -58,17 +71,18 @@ func (ctx *ApiCtx) Filetree() *filetree.FileTreeCtx {
 }
 
 func (ctx *ApiCtx) Refresh() error {
-	err := ctx.hashTree.Mirror(ctx.blobStorage, concurrent)
+	err := ctx.hashTree.Mirror(ctx.blobStorage, ctx.concurrent)
 	if err != nil {
 		return err
 	}
 	ctx.ft = DocumentsFileTree(ctx.hashTree)
+	saveTree(ctx.hashTree)
 	return nil
 }
 
 // Nuke removes all documents from the account
 func (ctx *ApiCtx) Nuke() (err error) {
-	err = Sync(ctx.blobStorage, ctx.hashTree, func(t *HashTree) error {
+	err = ctx.sync(&JournalRecord{Operation: "nuke"}, func(t *HashTree) error {
 		ctx.hashTree.Docs = nil
 		ctx.hashTree.Rehash()
 		return nil
@@ -80,6 +94,15 @@ func (ctx *ApiCtx) Nuke() (err error) {
 	return ctx.SyncComplete()
 }
 
+// DocumentHash returns the hash of the index of a document
+func (ctx *ApiCtx) DocumentHash(docId string) (string, error) {
+	doc, err := ctx.hashTree.FindDoc(docId)
+	if err != nil {
+		return "", err
+	}
+	return doc.Hash, nil
+}
+
 // FetchDocument downloads a document given its ID and saves it locally into dstPath
 func (ctx *ApiCtx) FetchDocument(docId, dstPath string) error {
 	doc, err := ctx.hashTree.FindDoc(docId)
@@ -155,6 +178,7 @@ func (ctx *ApiCtx) CreateDir(parentId, name string, notify bool) (*model.Documen
 	files.AddMap(objectName, filePath)
 
 	doc := NewBlobDoc(name, id, model.DirectoryType, parentId)
+	doc.SchemaVersion = ctx.hashTree.SchemaVersion
 
 	for _, f := range files.Files {
 		log.Info.Printf("File %s, path: %s", f.Name, f.Path)
@@ -180,6 +204,9 @@ func (ctx *ApiCtx) CreateDir(parentId, name string, notify bool) (*model.Documen
 		}
 
 		doc.AddFile(fileEntry)
+		if strings.HasSuffix(f.Name, ".content") {
+			doc.Content = contentInfoFile(f.Path, hashStr)
+		}
 	}
 
 	log.Info.Println("Uploading new doc index...", doc.Hash)
@@ -193,7 +220,7 @@ func (ctx *ApiCtx) CreateDir(parentId, name string, notify bool) (*model.Documen
 		return nil, err
 	}
 
-	err = Sync(ctx.blobStorage, ctx.hashTree, func(t *HashTree) error {
+	err = ctx.sync(&JournalRecord{Operation: "mkdir " + name}, func(t *HashTree) error {
 		return t.Add(doc)
 	})
 
@@ -211,8 +238,9 @@ func (ctx *ApiCtx) CreateDir(parentId, name string, notify bool) (*model.Documen
 	return doc.ToDocument(), nil
 }
 
-// Sync applies changes to the local tree and syncs with the remote storage
-func Sync(b *BlobStorage, tree *HashTree, operation func(t *HashTree) error) error {
+// Sync applies changes to the local tree and syncs with the remote storage,
+// mirroring it with up to maxconcurrent requests when it changed meanwhile
+func Sync(b BlobStore, tree *HashTree, maxconcurrent int, operation func(t *HashTree) error) error {
 	synccount := 0
 	for {
 		synccount++
@@ -252,7 +280,7 @@ func Sync(b *BlobStorage, tree *HashTree, operation func(t *HashTree) error) err
 
 		log.Info.Println("wrong generation, re-reading remote tree")
 		//resync and try again
-		err = tree.Mirror(b, concurrent)
+		err = tree.Mirror(b, maxconcurrent)
 		if err != nil {
 			return err
 		}
@@ -267,7 +295,7 @@ func (ctx *ApiCtx) DeleteEntry(node *model.Node) error {
 		return errors.New("directory is not empty")
 	}
 
-	err := Sync(ctx.blobStorage, ctx.hashTree, func(t *HashTree) error {
+	err := ctx.sync(&JournalRecord{Operation: "rm " + node.Name()}, func(t *HashTree) error {
 		return t.Remove(node.Document.ID)
 	})
 	if err != nil {
@@ -287,7 +315,7 @@ func (ctx *ApiCtx) MoveEntry(src, dstDir *model.Node, name string) (*model.Node,
 	}
 	var err error
 
-	err = Sync(ctx.blobStorage, ctx.hashTree, func(t *HashTree) error {
+	err = ctx.sync(&JournalRecord{Operation: "mv " + src.Name() + " " + name}, func(t *HashTree) error {
 		doc, err := t.FindDoc(src.Document.ID)
 		if err != nil {
 			return err
@@ -365,12 +393,18 @@ func (ctx *ApiCtx) UploadDocument(parentId string, sourceDocPath string, notify
 
 	defer os.RemoveAll(tmpDir)
 
+	sourceDocPath, ext, err = convert.Prepare(sourceDocPath, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
 	docFiles, id, err := archive.Prepare(name, parentId, sourceDocPath, ext, tmpDir)
 	if err != nil {
 		return nil, err
 	}
 
 	doc := NewBlobDoc(name, id, model.DocumentType, parentId)
+	doc.SchemaVersion = ctx.hashTree.SchemaVersion
 	for _, f := range docFiles.Files {
 		log.Info.Printf("File %s, path: %s", f.Name, f.Path)
 		hash, size, err := FileHashAndSize(f.Path)
@@ -395,6 +429,9 @@ func (ctx *ApiCtx) UploadDocument(parentId string, sourceDocPath string, notify
 		}
 
 		doc.AddFile(fileEntry)
+		if strings.HasSuffix(f.Name, ".content") {
+			doc.Content = contentInfoFile(f.Path, hashStr)
+		}
 	}
 
 	log.Info.Println("Uploading new doc index...", doc.Hash)
@@ -408,7 +445,7 @@ func (ctx *ApiCtx) UploadDocument(parentId string, sourceDocPath string, notify
 		return nil, err
 	}
 
-	err = Sync(ctx.blobStorage, ctx.hashTree, func(t *HashTree) error {
+	err = ctx.sync(&JournalRecord{Operation: "put " + name}, func(t *HashTree) error {
 		return t.Add(doc)
 	})
 
@@ -425,6 +462,124 @@ func (ctx *ApiCtx) UploadDocument(parentId string, sourceDocPath string, notify
 	return doc.ToDocument(), nil
 }
 
+// ReplaceDocument replaces the files of the document docId with the ones of the archive sourceZipPath.
+// The metadata of the document is kept, so it stays in place with the same name.
+func (ctx *ApiCtx) ReplaceDocument(docId string, sourceZipPath string, notify bool) (*model.Document, error) {
+	tmpDir, err := os.MkdirTemp("", "rmupload")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	id, docFiles, _, err := archive.Unpack(sourceZipPath, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	if id != docId {
+		return nil, errors.New("the archive belongs to a different document")
+	}
+
+	files := make([]*Entry, 0)
+	var info ContentInfo
+	for _, f := range docFiles.Files {
+		if strings.HasSuffix(f.Name, ".metadata") {
+			continue
+		}
+		log.Info.Printf("File %s, path: %s", f.Name, f.Path)
+		hash, size, err := FileHashAndSize(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		hashStr := hex.EncodeToString(hash)
+		if strings.HasSuffix(f.Name, ".content") {
+			info = contentInfoFile(f.Path, hashStr)
+		}
+		reader, err := os.Open(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		err = ctx.blobStorage.UploadBlob(hashStr, reader)
+		reader.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, &Entry{
+			DocumentID: f.Name,
+			Hash:       hashStr,
+			Type:       FileType,
+			Size:       size,
+		})
+	}
+
+	err = ctx.sync(&JournalRecord{Operation: "replace " + docId}, func(t *HashTree) error {
+		doc, err := t.FindDoc(docId)
+		if err != nil {
+			return err
+		}
+
+		newFiles := append([]*Entry{}, files...)
+		for _, f := range doc.Files {
+			if strings.HasSuffix(f.DocumentID, ".metadata") {
+				newFiles = append(newFiles, f)
+			}
+		}
+		doc.Files = newFiles
+		doc.Content = info
+
+		doc.Metadata.Version += 1
+		doc.Metadata.LastModified = archive.UnixTimestamp()
+		doc.Metadata.MetadataModified = true
+		doc.Metadata.Modified = true
+
+		hashStr, reader, err := doc.MetadataHashAndReader()
+		if err != nil {
+			return err
+		}
+		err = ctx.blobStorage.UploadBlob(hashStr, reader)
+		if err != nil {
+			return err
+		}
+
+		err = doc.Rehash()
+		if err != nil {
+			return err
+		}
+		err = t.Rehash()
+		if err != nil {
+			return err
+		}
+
+		log.Info.Println("Uploading new doc index...", doc.Hash)
+		indexReader, err := doc.IndexReader()
+		if err != nil {
+			return err
+		}
+		defer indexReader.Close()
+		return ctx.blobStorage.UploadBlob(doc.Hash, indexReader)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if notify {
+		err = ctx.SyncComplete()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	doc, err := ctx.hashTree.FindDoc(docId)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.ToDocument(), nil
+}
+
 // DocumentsFileTree reads your remote documents and builds a file tree
 // structure to represent them
 func DocumentsFileTree(tree *HashTree) *filetree.FileTreeCtx {
@@ -452,8 +607,31 @@ func DocumentsFileTree(tree *HashTree) *filetree.FileTreeCtx {
 	return &fileTree
 }
 
+// BeginBatch defers the notifications of the next operations to the end of the batch, batches can be nested
+func (ctx *ApiCtx) BeginBatch() {
+	ctx.batch++
+}
+
+// EndBatch ends a batch and notifies the tablets once at the end of the outermost one if something changed
+func (ctx *ApiCtx) EndBatch() error {
+	if ctx.batch == 0 {
+		return nil
+	}
+	ctx.batch--
+	if ctx.batch > 0 || !ctx.syncPending {
+		return nil
+	}
+	ctx.syncPending = false
+	return ctx.SyncComplete()
+}
+
 // SyncComplete notfies that somethings has changed (triggers tablet sync)
 func (ctx *ApiCtx) SyncComplete() error {
+	if ctx.batch > 0 {
+		ctx.syncPending = true
+		return nil
+	}
+
 	err := ctx.blobStorage.SyncComplete(ctx.hashTree.Generation)
 
 	//sync can be called once per generation, ignore the error if nothing was changed
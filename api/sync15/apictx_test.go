@@ -0,0 +1,38 @@
+package sync15
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "rmapi.conf")
+	if err := os.WriteFile(configFile, []byte("cachedir: "+dir+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RMAPI_CONFIG", configFile)
+
+	ctx, store := newMemCtx(t)
+
+	ctx.BeginBatch()
+	ctx.BeginBatch()
+	for _, name := range []string{"one", "two"} {
+		if _, err := ctx.CreateDir("", name, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.NoError(t, ctx.EndBatch())
+	assert.Empty(t, store.syncs)
+
+	assert.NoError(t, ctx.EndBatch())
+	assert.Equal(t, []int64{store.generation}, store.syncs)
+
+	// nothing changed in the batch
+	ctx.BeginBatch()
+	assert.NoError(t, ctx.EndBatch())
+	assert.Len(t, store.syncs, 1)
+}
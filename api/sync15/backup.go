@@ -0,0 +1,487 @@
+package sync15
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juruen/rmapi/filetree"
+	"github.com/juruen/rmapi/log"
+	"github.com/juruen/rmapi/model"
+	"golang.org/x/sync/errgroup"
+)
+
+const manifestName = "manifest.json"
+const blobsDir = "blobs"
+
+// trashId is the parent of the documents in the trash
+const trashId = "trash"
+
+// Manifest describes a backup of an account. The blobs of the backup are stored
+// by hash next to it, so a directory can hold the blobs of several backups.
+// A directory keeps the manifest of each backup as manifest-<generation>.json,
+// and manifest.json is the latest one.
+type Manifest struct {
+	Created       time.Time
+	RootHash      string
+	Generation    int64
+	SchemaVersion string
+	Documents     int
+	Blobs         int
+}
+
+// Backup saves the root index and every document index and file of the account into dst,
+// a directory or a .zip file. Blobs already present in a directory are not downloaded again.
+// The account is refreshed first, so its file tree is rebuilt.
+func (ctx *ApiCtx) Backup(dst string) (*Manifest, error) {
+	if err := ctx.Refresh(); err != nil {
+		return nil, err
+	}
+	tree := ctx.hashTree
+
+	var store backupWriter
+	var err error
+	if strings.EqualFold(filepath.Ext(dst), ".zip") {
+		store, err = createZipBackup(dst)
+	} else {
+		store, err = createDirBackup(dst)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, 0)
+	if tree.Hash != "" {
+		hashes = append(hashes, tree.Hash)
+	}
+	for _, d := range tree.Docs {
+		hashes = append(hashes, d.Hash)
+		for _, f := range d.Files {
+			hashes = append(hashes, f.Hash)
+		}
+	}
+
+	seen := make(map[string]bool)
+	wg, _ := errgroup.WithContext(context.TODO())
+	wg.SetLimit(ctx.concurrent)
+	for _, h := range hashes {
+		if seen[h] {
+			continue
+		}
+		seen[h] = true
+		if store.has(h) {
+			log.Trace.Println("blob already backed up: ", h)
+			continue
+		}
+
+		hash := h
+		wg.Go(func() error {
+			log.Trace.Println("backing up blob: ", hash)
+			r, err := ctx.blobStorage.GetReader(hash)
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			return store.put(hash, r)
+		})
+	}
+	if err = wg.Wait(); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Created:       time.Now(),
+		RootHash:      tree.Hash,
+		Generation:    tree.Generation,
+		SchemaVersion: tree.SchemaVersion,
+		Documents:     len(tree.Docs),
+		Blobs:         len(seen),
+	}
+	if err = store.writeManifest(manifest); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	return manifest, store.Close()
+}
+
+// Restore uploads the documents of the backup src that are missing in the account.
+//   - targetId is the directory where the top level documents of the backup are placed
+//   - paths restricts the restore to these entries of the backup, and their contents
+//   - dryRun only returns the documents that would be restored
+//
+// Documents whose id already exists in the account are skipped.
+func (ctx *ApiCtx) Restore(src, targetId string, paths []string, dryRun bool) ([]*model.Document, error) {
+	backup, err := OpenBackup(src)
+	if err != nil {
+		return nil, err
+	}
+	defer backup.Close()
+
+	tree := &HashTree{}
+	if err = tree.Mirror(backup, ctx.concurrent); err != nil {
+		return nil, err
+	}
+
+	selected, err := selectDocs(tree, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ctx.Refresh(); err != nil {
+		return nil, err
+	}
+
+	restored := make([]*BlobDoc, 0)
+	moved := make(map[string]bool)
+	for _, d := range tree.Docs {
+		if !selected[d.DocumentID] {
+			continue
+		}
+		if _, err := ctx.hashTree.FindDoc(d.DocumentID); err == nil {
+			log.Warning.Printf("%s already exists, skipping", d.Metadata.DocName)
+			continue
+		}
+		parent := d.Metadata.Parent
+		if !selected[parent] && parent != trashId && parent != targetId {
+			d.Metadata.Parent = targetId
+			d.Metadata.Version += 1
+			d.Metadata.MetadataModified = true
+			moved[d.DocumentID] = true
+		}
+		restored = append(restored, d)
+	}
+
+	documents := make([]*model.Document, 0, len(restored))
+	for _, d := range restored {
+		documents = append(documents, d.ToDocument())
+	}
+	if dryRun || len(restored) == 0 {
+		return documents, nil
+	}
+
+	wg, _ := errgroup.WithContext(context.TODO())
+	wg.SetLimit(ctx.concurrent)
+	for _, d := range restored {
+		doc := d
+		wg.Go(func() error {
+			return ctx.restoreDoc(backup, doc, moved[doc.DocumentID])
+		})
+	}
+	if err = wg.Wait(); err != nil {
+		return nil, err
+	}
+
+	err = ctx.sync(&JournalRecord{Operation: "restore " + src}, func(t *HashTree) error {
+		for _, d := range restored {
+			if _, err := t.FindDoc(d.DocumentID); err == nil {
+				continue
+			}
+			t.Docs = append(t.Docs, d)
+		}
+		return t.Rehash()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx.ft = DocumentsFileTree(ctx.hashTree)
+	return documents, ctx.SyncComplete()
+}
+
+// restoreDoc uploads the files of a document from the backup, and its index
+// written with the schema of the account. The metadata is written again if the document was moved.
+func (ctx *ApiCtx) restoreDoc(backup *Backup, doc *BlobDoc, moved bool) error {
+	for _, f := range doc.Files {
+		if strings.HasSuffix(f.DocumentID, ".metadata") && moved {
+			continue
+		}
+		r, err := backup.GetReader(f.Hash)
+		if err != nil {
+			return err
+		}
+		err = ctx.blobStorage.UploadBlob(f.Hash, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if moved {
+		hashStr, reader, err := doc.MetadataHashAndReader()
+		if err != nil {
+			return err
+		}
+		if err = ctx.blobStorage.UploadBlob(hashStr, reader); err != nil {
+			return err
+		}
+	}
+
+	doc.SchemaVersion = ctx.hashTree.SchemaVersion
+	if err := doc.Rehash(); err != nil {
+		return err
+	}
+
+	log.Info.Println("Uploading restored doc index...", doc.Hash)
+	indexReader, err := doc.IndexReader()
+	if err != nil {
+		return err
+	}
+	defer indexReader.Close()
+	return ctx.blobStorage.UploadBlob(doc.Hash, indexReader)
+}
+
+// selectDocs returns the ids of the documents found at paths and their contents,
+// or of all the documents if no path is given
+func selectDocs(tree *HashTree, paths []string) (map[string]bool, error) {
+	selected := make(map[string]bool)
+	if len(paths) == 0 {
+		for _, d := range tree.Docs {
+			if !d.Metadata.Deleted {
+				selected[d.DocumentID] = true
+			}
+		}
+		return selected, nil
+	}
+
+	ft := DocumentsFileTree(tree)
+	for _, p := range paths {
+		node, err := ft.NodeByPath(p, ft.Root())
+		if err != nil {
+			return nil, fmt.Errorf("%s not found in the backup", p)
+		}
+		filetree.WalkTree(node, filetree.FileTreeVistor{
+			Visit: func(n *model.Node, _ []string) bool {
+				if !n.IsRoot() {
+					selected[n.Id()] = true
+				}
+				return filetree.ContinueVisiting
+			},
+		})
+	}
+
+	return selected, nil
+}
+
+// A Backup gives access to the blobs of a backup as if it was the remote storage
+type Backup struct {
+	Manifest Manifest
+	dir      string
+	zip      *zip.ReadCloser
+	files    map[string]*zip.File
+}
+
+// OpenBackup opens a backup directory or .zip file. The manifest of an earlier backup
+// of a directory, like backups/manifest-42.json, opens that backup.
+func OpenBackup(src string) (*Backup, error) {
+	b := &Backup{}
+
+	fi, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest []byte
+	if fi.IsDir() {
+		b.dir = src
+		manifest, err = os.ReadFile(filepath.Join(src, manifestName))
+	} else if strings.EqualFold(filepath.Ext(src), ".json") {
+		b.dir = filepath.Dir(src)
+		manifest, err = os.ReadFile(src)
+	} else {
+		manifest, err = b.openZip(src)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a backup: %v", src, err)
+	}
+
+	if err = json.Unmarshal(manifest, &b.Manifest); err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *Backup) openZip(src string) ([]byte, error) {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	b.zip = r
+	b.files = make(map[string]*zip.File)
+	for _, f := range r.File {
+		b.files[f.Name] = f
+	}
+
+	f, ok := b.files[manifestName]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", manifestName)
+	}
+	return readZipFile(f)
+}
+
+// GetRootIndex returns the root of the backed up tree
+func (b *Backup) GetRootIndex() (string, int64, error) {
+	return b.Manifest.RootHash, b.Manifest.Generation, nil
+}
+
+// GetReader reads a blob of the backup
+func (b *Backup) GetReader(hash string) (io.ReadCloser, error) {
+	if b.zip == nil {
+		return os.Open(filepath.Join(b.dir, blobsDir, hash))
+	}
+
+	f, ok := b.files[path.Join(blobsDir, hash)]
+	if !ok {
+		return nil, fmt.Errorf("blob %s not found in the backup", hash)
+	}
+	return f.Open()
+}
+
+func (b *Backup) Close() error {
+	if b.zip != nil {
+		return b.zip.Close()
+	}
+	return nil
+}
+
+type backupWriter interface {
+	has(hash string) bool
+	put(hash string, r io.Reader) error
+	writeManifest(m *Manifest) error
+	Close() error
+}
+
+type dirBackup struct {
+	dir string
+}
+
+func createDirBackup(dir string) (*dirBackup, error) {
+	if err := os.MkdirAll(filepath.Join(dir, blobsDir), 0700); err != nil {
+		return nil, err
+	}
+	return &dirBackup{dir}, nil
+}
+
+func (d *dirBackup) has(hash string) bool {
+	_, err := os.Stat(filepath.Join(d.dir, blobsDir, hash))
+	return err == nil
+}
+
+// put writes to a temporary file first, so an interrupted backup doesn't leave partial blobs
+func (d *dirBackup) put(hash string, r io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Join(d.dir, blobsDir), ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(d.dir, blobsDir, hash))
+}
+
+// writeManifest keeps the manifest of each generation, manifest.json is the latest backup
+func (d *dirBackup) writeManifest(m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(filepath.Join(d.dir, generationManifest(m.Generation)), data, 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(d.dir, manifestName), data, 0600)
+}
+
+// generationManifest is the name of the manifest of the backup of a generation
+func generationManifest(generation int64) string {
+	return fmt.Sprintf("manifest-%d.json", generation)
+}
+
+func (d *dirBackup) Close() error {
+	return nil
+}
+
+type zipBackup struct {
+	file *os.File
+	w    *zip.Writer
+	mu   sync.Mutex
+}
+
+func createZipBackup(dst string) (*zipBackup, error) {
+	f, err := os.Create(dst)
+	if err != nil {
+		return nil, err
+	}
+	return &zipBackup{file: f, w: zip.NewWriter(f)}, nil
+}
+
+func (z *zipBackup) has(hash string) bool {
+	return false
+}
+
+func (z *zipBackup) put(hash string, r io.Reader) error {
+	// blobs are downloaded concurrently but the archive is written one file at a time
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.write(path.Join(blobsDir, hash), data)
+}
+
+func (z *zipBackup) writeManifest(m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.write(manifestName, data)
+}
+
+func (z *zipBackup) write(name string, data []byte) error {
+	w, err := z.w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, bytes.NewReader(data))
+	return err
+}
+
+func (z *zipBackup) Close() error {
+	err := z.w.Close()
+	if cerr := z.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
@@ -0,0 +1,143 @@
+package sync15
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/juruen/rmapi/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestBackup stores a tree with a folder and a document inside it
+func writeTestBackup(t *testing.T, store backupWriter) *HashTree {
+	tree := &HashTree{SchemaVersion: SchemaVersion4}
+
+	for _, d := range []*BlobDoc{
+		NewBlobDoc("Books", "folder", model.DirectoryType, ""),
+		NewBlobDoc("novel", "doc", model.DocumentType, "folder"),
+	} {
+		d.SchemaVersion = SchemaVersion4
+		d.Files = []*Entry{{DocumentID: d.DocumentID + ".metadata", Type: FileType}}
+		hash, reader, err := d.MetadataHashAndReader()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = store.put(hash, reader); err != nil {
+			t.Fatal(err)
+		}
+		if err = d.Rehash(); err != nil {
+			t.Fatal(err)
+		}
+		if err = store.put(d.Hash, bytes.NewReader(d.indexContent())); err != nil {
+			t.Fatal(err)
+		}
+		if err = tree.Add(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.put(tree.Hash, bytes.NewReader(tree.indexContent())); err != nil {
+		t.Fatal(err)
+	}
+	err := store.writeManifest(&Manifest{RootHash: tree.Hash, Generation: 7, SchemaVersion: tree.SchemaVersion, Documents: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return tree
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backup")
+	dirStore, err := createDirBackup(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipPath := filepath.Join(t.TempDir(), "backup.zip")
+	zipStore, err := createZipBackup(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for src, store := range map[string]backupWriter{dir: dirStore, zipPath: zipStore} {
+		expected := writeTestBackup(t, store)
+
+		backup, err := OpenBackup(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, int64(7), backup.Manifest.Generation)
+
+		tree := &HashTree{}
+		if err = tree.Mirror(backup, 2); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, expected.Hash, tree.Hash)
+		assert.Equal(t, SchemaVersion4, tree.SchemaVersion)
+
+		doc, err := tree.FindDoc("doc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, "novel", doc.Metadata.DocName)
+		assert.Equal(t, "folder", doc.Metadata.Parent)
+
+		r, err := backup.GetReader(doc.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		index, _ := io.ReadAll(r)
+		r.Close()
+		assert.Equal(t, doc.indexContent(), index)
+
+		selected, err := selectDocs(tree, []string{"/Books"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, map[string]bool{"folder": true, "doc": true}, selected)
+
+		selected, err = selectDocs(tree, []string{"/Books/novel"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, map[string]bool{"doc": true}, selected)
+
+		_, err = selectDocs(tree, []string{"/missing"})
+		assert.Error(t, err)
+
+		backup.Close()
+	}
+}
+
+func TestBackupGenerations(t *testing.T) {
+	dir := t.TempDir()
+	store, err := createDirBackup(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := writeTestBackup(t, store)
+	if err = store.writeManifest(&Manifest{RootHash: tree.Hash, Generation: 9}); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := OpenBackup(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(9), latest.Manifest.Generation)
+
+	earlier, err := OpenBackup(filepath.Join(dir, "manifest-7.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(7), earlier.Manifest.Generation)
+	r, err := earlier.GetReader(tree.Hash)
+	if assert.NoError(t, err) {
+		r.Close()
+	}
+}
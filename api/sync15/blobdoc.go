@@ -1,17 +1,16 @@
 package sync15
 
 import (
-	"bufio"
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/juruen/rmapi/archive"
 	"github.com/juruen/rmapi/log"
@@ -22,6 +21,54 @@ type BlobDoc struct {
 	Files []*Entry
 	Entry
 	Metadata archive.MetadataFile
+	// SchemaVersion is the schema of the index of the document
+	SchemaVersion string
+	// Content is what the listings show of the .content
+	Content ContentInfo
+}
+
+// ContentInfo is the file type and the number of pages of a document, read from its .content
+type ContentInfo struct {
+	FileType  string `json:",omitempty"`
+	PageCount int    `json:",omitempty"`
+	// Hash is the one of the .content read, it is read again once it changes
+	Hash string `json:",omitempty"`
+}
+
+// newContentInfo is the file type and the number of pages of a .content
+func newContentInfo(content *archive.Content, hash string) ContentInfo {
+	pages, _, _ := content.DocumentPages()
+	info := ContentInfo{FileType: content.FileType, PageCount: len(pages), Hash: hash}
+	if info.PageCount == 0 {
+		info.PageCount = content.PageCount
+	}
+	return info
+}
+
+// contentInfoFile reads the file type and the number of pages of a local .content,
+// nothing is known of them when it can't be read
+func contentInfoFile(path, hash string) ContentInfo {
+	f, err := os.Open(path)
+	if err != nil {
+		return ContentInfo{}
+	}
+	defer f.Close()
+
+	content := archive.Content{}
+	if err := json.NewDecoder(f).Decode(&content); err != nil {
+		return ContentInfo{}
+	}
+	return newContentInfo(&content, hash)
+}
+
+// contentHash is the hash of the .content of the document, empty when it has none
+func (d *BlobDoc) contentHash() string {
+	for _, f := range d.Files {
+		if strings.HasSuffix(f.DocumentID, ".content") {
+			return f.Hash
+		}
+	}
+	return ""
 }
 
 func NewBlobDoc(name, documentId, colType, parentId string) *BlobDoc {
@@ -40,8 +87,8 @@ func NewBlobDoc(name, documentId, colType, parentId string) *BlobDoc {
 }
 
 func (d *BlobDoc) Rehash() error {
-
-	hash, err := HashEntries(d.Files)
+	sort.Slice(d.Files, func(i, j int) bool { return d.Files[i].DocumentID < d.Files[j].DocumentID })
+	hash, err := hashIndex(d.SchemaVersion, d.indexContent(), d.Files)
 	if err != nil {
 		return err
 	}
@@ -84,6 +131,9 @@ func (t *HashTree) Add(d *BlobDoc) error {
 	if len(d.Files) == 0 {
 		return errors.New("no files")
 	}
+	if schemaOrDefault(d.SchemaVersion) != schemaOrDefault(t.SchemaVersion) {
+		return errors.New("the document index doesn't use the schema of the tree")
+	}
 	t.Docs = append(t.Docs, d)
 	return t.Rehash()
 }
@@ -92,20 +142,26 @@ func (d *BlobDoc) IndexReader() (io.ReadCloser, error) {
 	if len(d.Files) == 0 {
 		return nil, errors.New("no files")
 	}
-	pipeReader, pipeWriter := io.Pipe()
-	w := bufio.NewWriter(pipeWriter)
-	go func() {
-		defer pipeWriter.Close()
-		w.WriteString(SchemaVersion)
-		w.WriteString("\n")
-		for _, d := range d.Files {
-			w.WriteString(d.Line())
-			w.WriteString("\n")
-		}
-		w.Flush()
-	}()
 
-	return pipeReader, nil
+	return io.NopCloser(bytes.NewReader(d.indexContent())), nil
+}
+
+func (d *BlobDoc) indexContent() []byte {
+	lines := make([]string, 0, len(d.Files))
+	for _, f := range d.Files {
+		lines = append(lines, f.Line())
+	}
+
+	return indexContent(d.SchemaVersion, d.DocumentID, lines, d.filesSize())
+}
+
+// filesSize is the total size of the files of the document
+func (d *BlobDoc) filesSize() int64 {
+	var size int64
+	for _, f := range d.Files {
+		size += f.Size
+	}
+	return size
 }
 
 // ReadMetadata the document metadata from remote blob
@@ -150,7 +206,12 @@ func (d *BlobDoc) Line() string {
 	numFilesStr := strconv.Itoa(len(d.Files))
 	sb.WriteString(numFilesStr)
 	sb.WriteRune(Delimiter)
-	sb.WriteString("0")
+	// the size of documents is only used since schema 4
+	if d.SchemaVersion == SchemaVersion4 {
+		sb.WriteString(strconv.FormatInt(d.filesSize(), 10))
+	} else {
+		sb.WriteString("0")
+	}
 	return sb.String()
 }
 
@@ -162,10 +223,11 @@ func (d *BlobDoc) Mirror(e *Entry, r RemoteStorage) error {
 		return err
 	}
 	defer entryIndex.Close()
-	entries, err := parseIndex(entryIndex)
+	schema, entries, err := parseIndex(entryIndex)
 	if err != nil {
 		return err
 	}
+	d.SchemaVersion = schema
 
 	head := make([]*Entry, 0)
 	current := make(map[string]*Entry)
@@ -184,6 +246,7 @@ func (d *BlobDoc) Mirror(e *Entry, r RemoteStorage) error {
 					return err
 				}
 				currentEntry.Hash = newEntry.Hash
+				currentEntry.Size = newEntry.Size
 			}
 			head = append(head, currentEntry)
 			current[currentEntry.DocumentID] = currentEntry
@@ -206,24 +269,9 @@ func (d *BlobDoc) Mirror(e *Entry, r RemoteStorage) error {
 
 }
 func (d *BlobDoc) ToDocument() *model.Document {
-	var lastModified string
-	unixTime, err := strconv.ParseInt(d.Metadata.LastModified, 10, 64)
-	if err == nil {
-		//HACK: convert wrong nano timestamps to millis
-		if len(d.Metadata.LastModified) > 18 {
-			unixTime /= 1000000
-		}
-
-		t := time.Unix(unixTime/1000, 0)
-		lastModified = t.UTC().Format(time.RFC3339Nano)
-	}
-	return &model.Document{
-		ID:             d.DocumentID,
-		VissibleName:   d.Metadata.DocName,
-		Version:        d.Metadata.Version,
-		Parent:         d.Metadata.Parent,
-		Type:           d.Metadata.CollectionType,
-		CurrentPage:    d.Metadata.LastOpenedPage,
-		ModifiedClient: lastModified,
-	}
+	doc := d.Metadata.ToDocument(d.DocumentID)
+	doc.Size = d.filesSize()
+	doc.FileType = d.Content.FileType
+	doc.PageCount = d.Content.PageCount
+	return doc
 }
@@ -14,11 +14,14 @@ import (
 type BlobStorage struct {
 	http        *transport.HttpClientCtx
 	concurrency int
+	// urls are the endpoints of the account, each account has its own
+	urls config.Urls
 }
 
-func NewBlobStorage(http *transport.HttpClientCtx) *BlobStorage {
+func NewBlobStorage(http *transport.HttpClientCtx, urls config.Urls) *BlobStorage {
 	return &BlobStorage{
 		http: http,
+		urls: urls,
 	}
 }
 
@@ -34,7 +37,7 @@ func (b *BlobStorage) PutRootUrl(hash string, gen int64) (string, int64, error)
 	}
 	var res model.BlobStorageResponse
 
-	if err := b.http.Post(transport.UserBearer, config.UploadBlob, req, &res); err != nil {
+	if err := b.http.Post(transport.UserBearer, b.urls.UploadBlob, req, &res); err != nil {
 		return "", 0, err
 	}
 	return res.Url, res.MaxUploadSizeBytes, nil
@@ -45,7 +48,7 @@ func (b *BlobStorage) PutUrl(hash string) (string, int64, error) {
 	var res model.BlobStorageResponse
 	req.Method = http.MethodPut
 	req.RelativePath = hash
-	if err := b.http.Post(transport.UserBearer, config.UploadBlob, req, &res); err != nil {
+	if err := b.http.Post(transport.UserBearer, b.urls.UploadBlob, req, &res); err != nil {
 		return "", 0, err
 	}
 	return res.Url, res.MaxUploadSizeBytes, nil
@@ -57,7 +60,7 @@ func (b *BlobStorage) GetUrl(hash string) (string, error) {
 	var res model.BlobStorageResponse
 	req.Method = http.MethodGet
 	req.RelativePath = hash
-	if err := b.http.Post(transport.UserBearer, config.DownloadBlob, req, &res); err != nil {
+	if err := b.http.Post(transport.UserBearer, b.urls.DownloadBlob, req, &res); err != nil {
 		return "", err
 	}
 	return res.Url, nil
@@ -89,7 +92,7 @@ func (b *BlobStorage) SyncComplete(gen int64) error {
 	req := model.SyncCompletedRequest{
 		Generation: gen,
 	}
-	return b.http.Post(transport.UserBearer, config.SyncComplete, req, nil)
+	return b.http.Post(transport.UserBearer, b.urls.SyncComplete, req, nil)
 }
 
 func (b *BlobStorage) WriteRootIndex(roothash string, gen int64) (int64, error) {
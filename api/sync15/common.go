@@ -4,10 +4,15 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path"
 	"sort"
+	"strconv"
+	"time"
 
+	"github.com/juruen/rmapi/config"
 	"github.com/juruen/rmapi/log"
 )
 
@@ -27,28 +32,44 @@ func HashEntries(entries []*Entry) (string, error) {
 	return hashStr, nil
 }
 
-func getCachedTreePath() (string, error) {
-	cachedir, err := os.UserCacheDir()
+// getCachedTreePath returns the path of the cached tree of the account named profile
+func getCachedTreePath(profile string) (string, error) {
+	rmapiFolder, err := cacheDir(profile)
 	if err != nil {
 		return "", err
 	}
-	rmapiFolder := path.Join(cachedir, "rmapi")
 	err = os.MkdirAll(rmapiFolder, 0700)
 	if err != nil {
 		return "", err
 	}
 	cacheFile := path.Join(rmapiFolder, ".tree")
+	if profile != "" {
+		cacheFile += "-" + profile
+	}
 	return cacheFile, nil
 }
 
-const cacheVersion = 3
+// cacheDir is the cache directory of the profile, or the default one
+func cacheDir(profile string) (string, error) {
+	if settings, err := config.Settings(profile); err == nil && settings.CacheDir != "" {
+		return settings.CacheDir, nil
+	}
+
+	cachedir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(cachedir, "rmapi"), nil
+}
+
+const cacheVersion = 4
 
-func loadTree() (*HashTree, error) {
-	cacheFile, err := getCachedTreePath()
+func loadTree(profile string) (*HashTree, error) {
+	cacheFile, err := getCachedTreePath(profile)
 	if err != nil {
 		return nil, err
 	}
-	tree := &HashTree{}
+	tree := &HashTree{profile: profile}
 	if _, err := os.Stat(cacheFile); err == nil {
 		b, err := os.ReadFile(cacheFile)
 		if err != nil {
@@ -57,11 +78,11 @@ func loadTree() (*HashTree, error) {
 		err = json.Unmarshal(b, tree)
 		if err != nil {
 			log.Error.Println("cache corrupt")
-			return tree, nil
+			return &HashTree{profile: profile}, nil
 		}
 		if tree.CacheVersion != cacheVersion {
 			log.Info.Println("wrong cache file version, resync")
-			return &HashTree{}, nil
+			return &HashTree{profile: profile}, nil
 		}
 	}
 	log.Info.Println("cache loaded: ", cacheFile)
@@ -70,7 +91,10 @@ func loadTree() (*HashTree, error) {
 }
 
 func saveTree(tree *HashTree) error {
-	cacheFile, err := getCachedTreePath()
+	if tree.dryRun {
+		return nil
+	}
+	cacheFile, err := getCachedTreePath(tree.profile)
 	log.Info.Println("Writing cache: ", cacheFile)
 	if err != nil {
 		return err
@@ -81,5 +105,128 @@ func saveTree(tree *HashTree) error {
 		return err
 	}
 	err = os.WriteFile(cacheFile, b, 0644)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return saveSnapshot(tree.profile, tree.Generation, b)
+}
+
+// historySize is the number of generations of the tree kept to diff against
+const historySize = 10
+
+// historyDir is the directory of the snapshots of the tree of the account named profile
+func historyDir(profile string) (string, error) {
+	cacheFile, err := getCachedTreePath(profile)
+	if err != nil {
+		return "", err
+	}
+	return cacheFile + "-history", nil
+}
+
+// saveSnapshot keeps the cached tree of a generation, the file is named after the
+// generation and its modification time is when it was seen. Only the last
+// historySize generations are kept.
+func saveSnapshot(profile string, gen int64, content []byte) error {
+	if gen == 0 {
+		return nil
+	}
+
+	dir, err := historyDir(profile)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	file := path.Join(dir, strconv.FormatInt(gen, 10))
+	if _, err = os.Stat(file); err == nil {
+		return nil
+	}
+	if err = os.WriteFile(file, content, 0644); err != nil {
+		return err
+	}
+
+	gens, err := snapshots(profile)
+	if err != nil {
+		return err
+	}
+	for len(gens) > historySize {
+		os.Remove(path.Join(dir, strconv.FormatInt(gens[0], 10)))
+		gens = gens[1:]
+	}
+	return nil
+}
+
+// snapshots returns the generations with a snapshot, oldest first
+func snapshots(profile string) ([]int64, error) {
+	dir, err := historyDir(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	gens := make([]int64, 0, len(entries))
+	for _, e := range entries {
+		if gen, err := strconv.ParseInt(e.Name(), 10, 64); err == nil {
+			gens = append(gens, gen)
+		}
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i] < gens[j] })
+	return gens, nil
+}
+
+// loadSnapshot returns the tree of the generation gen, and when it was seen
+func loadSnapshot(profile string, gen int64) (*HashTree, time.Time, error) {
+	dir, err := historyDir(profile)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	file := path.Join(dir, strconv.FormatInt(gen, 10))
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("no snapshot of generation %d", gen)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	tree := &HashTree{}
+	if err = json.Unmarshal(b, tree); err != nil {
+		return nil, time.Time{}, fmt.Errorf("corrupt snapshot of generation %d: %v", gen, err)
+	}
+	return tree, fi.ModTime(), nil
+}
+
+// snapshotAt returns the last generation seen at t
+func snapshotAt(profile string, t time.Time) (int64, error) {
+	dir, err := historyDir(profile)
+	if err != nil {
+		return 0, err
+	}
+	gens, err := snapshots(profile)
+	if err != nil {
+		return 0, err
+	}
+	if len(gens) == 0 {
+		return 0, errors.New("no snapshot of the tree yet")
+	}
+
+	for i := len(gens) - 1; i >= 0; i-- {
+		fi, err := os.Stat(path.Join(dir, strconv.FormatInt(gens[i], 10)))
+		if err == nil && !fi.ModTime().After(t) {
+			return gens[i], nil
+		}
+	}
+	return 0, fmt.Errorf("no snapshot before %s, the oldest one is generation %d", t.Format(time.RFC3339), gens[0])
 }
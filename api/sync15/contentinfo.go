@@ -0,0 +1,52 @@
+package sync15
+
+import (
+	"context"
+
+	"github.com/juruen/rmapi/log"
+	"github.com/juruen/rmapi/model"
+	"golang.org/x/sync/errgroup"
+)
+
+// LoadContentInfo reads the file type and the number of pages of the documents of nodes
+// whose .content changed since it was last read, the mirror doesn't download them.
+// What is read is kept in the cached tree. A .content that can't be read is skipped,
+// it is only informative.
+func (ctx *ApiCtx) LoadContentInfo(nodes []*model.Node) error {
+	docs := docsById(ctx.hashTree)
+
+	stale := make(map[*model.Node]*BlobDoc)
+	for _, node := range nodes {
+		if node.Document == nil || node.IsDirectory() {
+			continue
+		}
+		doc, ok := docs[node.Id()]
+		if !ok || doc.Content.Hash == doc.contentHash() {
+			continue
+		}
+		stale[node] = doc
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	wg, _ := errgroup.WithContext(context.TODO())
+	wg.SetLimit(ctx.concurrent)
+	for n, d := range stale {
+		node, doc := n, d
+		wg.Go(func() error {
+			content, err := ctx.readContent(doc)
+			if err != nil {
+				log.Warning.Printf("cannot read content %s %v", doc.DocumentID, err)
+				return nil
+			}
+			doc.Content = newContentInfo(content, doc.contentHash())
+			node.Document.FileType = doc.Content.FileType
+			node.Document.PageCount = doc.Content.PageCount
+			return nil
+		})
+	}
+	wg.Wait()
+
+	return saveTree(ctx.hashTree)
+}
@@ -0,0 +1,50 @@
+package sync15
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/juruen/rmapi/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadContentInfo(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "rmapi.conf")
+	if err := os.WriteFile(configFile, []byte("cachedir: "+dir+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RMAPI_CONFIG", configFile)
+
+	ctx, store := newMemCtx(t)
+	content := []byte(`{"fileType":"pdf","pageCount":3}`)
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	store.blobs[hash] = content
+
+	doc, err := ctx.hashTree.FindDoc("doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Files = append(doc.Files, &Entry{DocumentID: "doc.content", Hash: hash, Type: FileType})
+	node := ctx.Filetree().NodeById("doc")
+
+	assert.NoError(t, ctx.LoadContentInfo([]*model.Node{node, ctx.Filetree().NodeById("folder")}))
+	assert.Equal(t, "pdf", node.Document.FileType)
+	assert.Equal(t, 3, node.Document.PageCount)
+	assert.Equal(t, hash, doc.Content.Hash)
+
+	// what was read isn't read again until the .content changes
+	delete(store.blobs, hash)
+	node.Document.PageCount = 0
+	assert.NoError(t, ctx.LoadContentInfo([]*model.Node{node}))
+	assert.Equal(t, 0, node.Document.PageCount)
+
+	// a .content that can't be read is skipped
+	doc.Files[len(doc.Files)-1].Hash = "missing"
+	assert.NoError(t, ctx.LoadContentInfo([]*model.Node{node}))
+	assert.Equal(t, hash, doc.Content.Hash)
+}
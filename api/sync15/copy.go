@@ -0,0 +1,149 @@
+package sync15
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/juruen/rmapi/archive"
+	"github.com/juruen/rmapi/filetree"
+	"github.com/juruen/rmapi/log"
+	"github.com/juruen/rmapi/model"
+	"golang.org/x/sync/errgroup"
+)
+
+// CopyFrom copies the entry node of the account src, and everything under it, into the directory
+// parentId with the given name. The files go straight from one blob storage to the other.
+// The copies get new ids, so src can also be this same account.
+// The copied documents are returned with the directories before their contents.
+func (ctx *ApiCtx) CopyFrom(src *ApiCtx, node *model.Node, parentId, name string) ([]*model.Document, error) {
+	newIds := make(map[string]string)
+	docs := make([]*BlobDoc, 0)
+
+	var err error
+	filetree.WalkTree(node, filetree.FileTreeVistor{
+		Visit: func(n *model.Node, _ []string) bool {
+			srcDoc, findErr := src.hashTree.FindDoc(n.Id())
+			if findErr != nil {
+				err = findErr
+				return filetree.StopVisiting
+			}
+
+			newIds[n.Id()] = uuid.New().String()
+			doc := &BlobDoc{
+				Entry:         Entry{DocumentID: newIds[n.Id()]},
+				Metadata:      srcDoc.Metadata,
+				SchemaVersion: ctx.hashTree.SchemaVersion,
+				Content:       srcDoc.Content,
+			}
+			doc.Metadata.LastModified = archive.UnixTimestamp()
+			doc.Metadata.MetadataModified = true
+			doc.Metadata.Synced = false
+			if n == node {
+				doc.Metadata.Parent = parentId
+				doc.Metadata.DocName = name
+			} else {
+				doc.Metadata.Parent = newIds[srcDoc.Metadata.Parent]
+			}
+
+			for _, f := range srcDoc.Files {
+				if strings.HasSuffix(f.DocumentID, ".metadata") {
+					continue
+				}
+				doc.Files = append(doc.Files, &Entry{
+					Hash:       f.Hash,
+					Type:       FileType,
+					DocumentID: doc.DocumentID + strings.TrimPrefix(f.DocumentID, srcDoc.DocumentID),
+					Size:       f.Size,
+				})
+			}
+			docs = append(docs, doc)
+			return filetree.ContinueVisiting
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make(map[string]bool)
+	for _, d := range docs {
+		for _, f := range d.Files {
+			blobs[f.Hash] = true
+		}
+	}
+
+	wg, _ := errgroup.WithContext(context.TODO())
+	wg.SetLimit(ctx.concurrent)
+	// within the same account the blobs are already there
+	if src.blobStorage != ctx.blobStorage {
+		for h := range blobs {
+			hash := h
+			wg.Go(func() error {
+				log.Trace.Println("copying blob: ", hash)
+				r, err := src.blobStorage.GetReader(hash)
+				if err != nil {
+					return err
+				}
+				defer r.Close()
+				return ctx.blobStorage.UploadBlob(hash, r)
+			})
+		}
+	}
+	for _, d := range docs {
+		doc := d
+		wg.Go(func() error {
+			return ctx.uploadCopy(doc)
+		})
+	}
+	if err = wg.Wait(); err != nil {
+		return nil, err
+	}
+
+	err = ctx.sync(&JournalRecord{Operation: "copy " + node.Name()}, func(t *HashTree) error {
+		t.Docs = append(t.Docs, docs...)
+		return t.Rehash()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	documents := make([]*model.Document, 0, len(docs))
+	for _, d := range docs {
+		documents = append(documents, d.ToDocument())
+	}
+
+	return documents, ctx.SyncComplete()
+}
+
+// uploadCopy uploads the metadata and the index of a copied document
+func (ctx *ApiCtx) uploadCopy(doc *BlobDoc) error {
+	metadata := &Entry{Type: FileType, DocumentID: doc.DocumentID + ".metadata"}
+	doc.Files = append(doc.Files, metadata)
+
+	hashStr, reader, err := doc.MetadataHashAndReader()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	metadata.Size = int64(len(data))
+	if err = ctx.blobStorage.UploadBlob(hashStr, bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	if err = doc.Rehash(); err != nil {
+		return err
+	}
+
+	log.Info.Println("Uploading copied doc index...", doc.Hash)
+	indexReader, err := doc.IndexReader()
+	if err != nil {
+		return err
+	}
+	defer indexReader.Close()
+	return ctx.blobStorage.UploadBlob(doc.Hash, indexReader)
+}
@@ -0,0 +1,167 @@
+package sync15
+
+import (
+	"encoding/json"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/juruen/rmapi/archive"
+	"github.com/juruen/rmapi/log"
+)
+
+// PageChanges are the pages of a document that changed, numbered from 1
+type PageChanges struct {
+	Added []int `json:"added,omitempty"`
+	// Removed are numbered as they were in the old version
+	Removed []int `json:"removed,omitempty"`
+	// Annotated are the pages whose annotations changed
+	Annotated []int `json:"annotated,omitempty"`
+}
+
+// Diff is what changed in the account between two generations
+type Diff struct {
+	From int64
+	// Since is when the generation From was seen
+	Since   time.Time
+	To      int64
+	Changes []Change
+}
+
+// Diff returns what changed since the start of the session, that is since the tree
+// was cached by the previous session. pages adds the page changes of the modified documents.
+func (ctx *ApiCtx) Diff(pages bool) (*Diff, error) {
+	return ctx.diffFrom(ctx.session, time.Time{}, pages)
+}
+
+// DiffSinceGeneration returns what changed since the generation gen, which has to be one of
+// the last generations seen
+func (ctx *ApiCtx) DiffSinceGeneration(gen int64, pages bool) (*Diff, error) {
+	if gen == ctx.session.Generation {
+		return ctx.Diff(pages)
+	}
+
+	tree, seen, err := loadSnapshot(ctx.hashTree.profile, gen)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.diffFrom(tree, seen, pages)
+}
+
+// DiffSinceTime returns what changed since the last generation seen at t
+func (ctx *ApiCtx) DiffSinceTime(t time.Time, pages bool) (*Diff, error) {
+	gen, err := snapshotAt(ctx.hashTree.profile, t)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.DiffSinceGeneration(gen, pages)
+}
+
+func (ctx *ApiCtx) diffFrom(old *HashTree, since time.Time, pages bool) (*Diff, error) {
+	if err := ctx.Refresh(); err != nil {
+		return nil, err
+	}
+
+	diff := &Diff{
+		From:    old.Generation,
+		Since:   since,
+		To:      ctx.hashTree.Generation,
+		Changes: DiffTrees(old, ctx.hashTree),
+	}
+	if !pages {
+		return diff, nil
+	}
+
+	for i, c := range diff.Changes {
+		if c.Type != ChangeModified {
+			continue
+		}
+		oldDoc, _ := old.FindDoc(c.ID)
+		newDoc, _ := ctx.hashTree.FindDoc(c.ID)
+		changes, err := ctx.pageChanges(oldDoc, newDoc)
+		if err != nil {
+			log.Warning.Printf("no page changes for %s: %v", c.Path, err)
+			continue
+		}
+		diff.Changes[i].Pages = changes
+	}
+
+	return diff, nil
+}
+
+// pageChanges compares the pages of two versions of a document
+func (ctx *ApiCtx) pageChanges(old, new *BlobDoc) (*PageChanges, error) {
+	newContent, err := ctx.readContent(new)
+	if err != nil {
+		return nil, err
+	}
+	// the old .content may be gone from the storage
+	oldContent, err := ctx.readContent(old)
+	if err != nil {
+		oldContent = newContent
+	}
+
+	oldIds, _, _ := oldContent.DocumentPages()
+	newIds, _, _ := newContent.DocumentPages()
+
+	oldPages := make(map[string]bool)
+	for _, id := range oldIds {
+		oldPages[id] = true
+	}
+	newPages := make(map[string]bool)
+	for _, id := range newIds {
+		newPages[id] = true
+	}
+
+	annotated := make(map[string]bool)
+	for _, f := range changedFiles(old, new) {
+		if strings.HasSuffix(f, ".rm") {
+			annotated[strings.TrimSuffix(path.Base(f), ".rm")] = true
+		}
+	}
+
+	changes := &PageChanges{}
+	for i, id := range newIds {
+		switch {
+		case !oldPages[id]:
+			changes.Added = append(changes.Added, i+1)
+		case annotated[id]:
+			changes.Annotated = append(changes.Annotated, i+1)
+		}
+	}
+	for i, id := range oldIds {
+		if !newPages[id] {
+			changes.Removed = append(changes.Removed, i+1)
+		}
+	}
+
+	return changes, nil
+}
+
+// readContent reads the .content of a document
+func (ctx *ApiCtx) readContent(doc *BlobDoc) (*archive.Content, error) {
+	if doc == nil {
+		return nil, errors.New("missing document")
+	}
+
+	for _, f := range doc.Files {
+		if !strings.HasSuffix(f.DocumentID, ".content") {
+			continue
+		}
+
+		r, err := ctx.blobStorage.GetReader(f.Hash)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		content := &archive.Content{}
+		if err = json.NewDecoder(r).Decode(content); err != nil {
+			return nil, err
+		}
+		return content, nil
+	}
+
+	return nil, errors.New("the document has no .content")
+}
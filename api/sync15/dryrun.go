@@ -0,0 +1,106 @@
+package sync15
+
+import (
+	"bytes"
+	"io"
+)
+
+// PlannedBlob is a blob that would be uploaded
+type PlannedBlob struct {
+	Hash string
+	Size int64
+}
+
+// Plan is what the operations run in dry-run mode would change in the account
+type Plan struct {
+	// RootHash is the new hash of the root index and Generation the one it would be written with
+	RootHash   string
+	Generation int64
+	Blobs      []PlannedBlob
+	Changes    []Change
+}
+
+// dryRunStorage reads from the storage of the account but only records what is written.
+// The blobs written are kept in memory, so the tree of the dry run can be read again.
+type dryRunStorage struct {
+	BlobStore
+	// base is the tree before the operations of the current plan
+	base       *HashTree
+	blobs      []PlannedBlob
+	uploaded   map[string][]byte
+	rootHash   string
+	generation int64
+	// written is set when the root index was written since the last plan
+	written bool
+}
+
+func (s *dryRunStorage) GetRootIndex() (string, int64, error) {
+	if s.rootHash != "" {
+		return s.rootHash, s.generation, nil
+	}
+	return s.BlobStore.GetRootIndex()
+}
+
+func (s *dryRunStorage) GetReader(hash string) (io.ReadCloser, error) {
+	if content, ok := s.uploaded[hash]; ok {
+		return io.NopCloser(bytes.NewReader(content)), nil
+	}
+	return s.BlobStore.GetReader(hash)
+}
+
+func (s *dryRunStorage) UploadBlob(hash string, reader io.Reader) error {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.uploaded[hash]; !ok {
+		s.uploaded[hash] = content
+		s.blobs = append(s.blobs, PlannedBlob{Hash: hash, Size: int64(len(content))})
+	}
+	return nil
+}
+
+func (s *dryRunStorage) WriteRootIndex(roothash string, gen int64) (int64, error) {
+	s.rootHash = roothash
+	s.generation = gen + 1
+	s.written = true
+	return s.generation, nil
+}
+
+func (s *dryRunStorage) SyncComplete(gen int64) error {
+	return nil
+}
+
+// DryRun returns a context that runs the operations against a copy of the tree of the account.
+// Blobs are read from the account but nothing is uploaded, and TakePlan tells what would change.
+func (ctx *ApiCtx) DryRun() *ApiCtx {
+	tree := ctx.hashTree.Clone()
+	tree.dryRun = true
+
+	storage := &dryRunStorage{
+		BlobStore: ctx.blobStorage,
+		base:      tree.Clone(),
+		uploaded:  make(map[string][]byte),
+	}
+	return &ApiCtx{Http: ctx.Http, ft: DocumentsFileTree(tree), blobStorage: storage, hashTree: tree, session: ctx.session, concurrent: ctx.concurrent}
+}
+
+// TakePlan returns what the operations run since the previous call would change,
+// nil when the context isn't a dry run or the root index wasn't written
+func (ctx *ApiCtx) TakePlan() *Plan {
+	s, ok := ctx.blobStorage.(*dryRunStorage)
+	if !ok || !s.written {
+		return nil
+	}
+
+	plan := &Plan{
+		RootHash:   s.rootHash,
+		Generation: s.generation,
+		Blobs:      s.blobs,
+		Changes:    DiffTrees(s.base, ctx.hashTree),
+	}
+	s.base = ctx.hashTree.Clone()
+	s.blobs = nil
+	s.written = false
+	return plan
+}
@@ -0,0 +1,119 @@
+package sync15
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/juruen/rmapi/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// memStore is a blob store in memory
+type memStore struct {
+	blobs      map[string][]byte
+	rootHash   string
+	generation int64
+	// syncs are the generations notified with SyncComplete
+	syncs []int64
+}
+
+func (s *memStore) GetRootIndex() (string, int64, error) {
+	return s.rootHash, s.generation, nil
+}
+
+func (s *memStore) GetReader(hash string) (io.ReadCloser, error) {
+	b, ok := s.blobs[hash]
+	if !ok {
+		return nil, errors.New("missing blob " + hash)
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (s *memStore) UploadBlob(hash string, reader io.Reader) error {
+	b, err := io.ReadAll(reader)
+	s.blobs[hash] = b
+	return err
+}
+
+func (s *memStore) WriteRootIndex(roothash string, gen int64) (int64, error) {
+	s.rootHash = roothash
+	s.generation = gen + 1
+	return s.generation, nil
+}
+
+func (s *memStore) SyncComplete(gen int64) error {
+	s.syncs = append(s.syncs, gen)
+	return nil
+}
+
+// newMemCtx returns the context of an account in memory with the folder Books and the document novel in it
+func newMemCtx(t *testing.T) (*ApiCtx, *memStore) {
+	store := &memStore{blobs: make(map[string][]byte)}
+	tree := &HashTree{SchemaVersion: SchemaVersion4}
+	for _, d := range []*BlobDoc{
+		NewBlobDoc("Books", "folder", model.DirectoryType, ""),
+		NewBlobDoc("novel", "doc", model.DocumentType, "folder"),
+	} {
+		d.SchemaVersion = SchemaVersion4
+		d.Files = []*Entry{{DocumentID: d.DocumentID + ".metadata", Type: FileType}}
+		if err := d.Rehash(); err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Add(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tree.Generation = 7
+	store.rootHash = tree.Hash
+	store.generation = tree.Generation
+
+	return &ApiCtx{ft: DocumentsFileTree(tree), blobStorage: store, hashTree: tree, session: tree.Clone(), concurrent: 2}, store
+}
+
+func TestDryRun(t *testing.T) {
+	ctx, store := newMemCtx(t)
+	tree := ctx.hashTree
+	dryRun := ctx.DryRun()
+	assert.Nil(t, dryRun.TakePlan())
+
+	node := dryRun.Filetree().NodeById("doc")
+	if _, err := dryRun.MoveEntry(node, dryRun.Filetree().Root(), "renamed"); err != nil {
+		t.Fatal(err)
+	}
+
+	plan := dryRun.TakePlan()
+	if assert.NotNil(t, plan) {
+		assert.Equal(t, dryRun.hashTree.Hash, plan.RootHash)
+		assert.Equal(t, int64(8), plan.Generation)
+		// the metadata, the index of the document and the root index
+		assert.Len(t, plan.Blobs, 3)
+		if assert.Len(t, plan.Changes, 1) {
+			assert.Equal(t, ChangeMoved, plan.Changes[0].Type)
+			assert.Equal(t, "/Books/novel", plan.Changes[0].OldPath)
+			assert.Equal(t, "/renamed", plan.Changes[0].Path)
+		}
+	}
+	assert.Nil(t, dryRun.TakePlan())
+
+	// the tree of the dry run can be read again
+	if assert.NoError(t, dryRun.Refresh()) {
+		assert.NotNil(t, dryRun.Filetree().NodeById("doc"))
+		_, err := dryRun.Filetree().NodeByPath("/renamed", nil)
+		assert.NoError(t, err)
+	}
+	if r, err := dryRun.blobStorage.GetReader(dryRun.hashTree.Hash); assert.NoError(t, err) {
+		r.Close()
+	}
+
+	// nothing was written and the tree of the account is unchanged
+	assert.Empty(t, store.blobs)
+	assert.Equal(t, tree.Hash, store.rootHash)
+	assert.Equal(t, int64(7), store.generation)
+	doc, err := tree.FindDoc("doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "novel", doc.Metadata.DocName)
+}
@@ -0,0 +1,213 @@
+package sync15
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/juruen/rmapi/log"
+)
+
+// JournalEntry is a document changed by an operation.
+// Before is nil when the document was added and After when it was deleted.
+type JournalEntry struct {
+	ID     string
+	Before *BlobDoc `json:",omitempty"`
+	After  *BlobDoc `json:",omitempty"`
+}
+
+// JournalRecord is an operation that changed the account, identified by the generation it wrote
+type JournalRecord struct {
+	Time      time.Time
+	Operation string
+	// Undoes is the generation of the record undone by this one
+	Undoes         int64 `json:",omitempty"`
+	FromGeneration int64
+	ToGeneration   int64
+	Entries        []JournalEntry
+}
+
+// journalPath is the path of the journal of the account named profile
+func journalPath(profile string) (string, error) {
+	cacheFile, err := getCachedTreePath(profile)
+	if err != nil {
+		return "", err
+	}
+	return cacheFile + "-journal", nil
+}
+
+// appendJournal adds a record at the end of the journal, one JSON record per line
+func appendJournal(profile string, record *JournalRecord) error {
+	journal, err := journalPath(profile)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(journal, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadJournal returns the records of the journal of the account named profile, the oldest first
+func ReadJournal(profile string) ([]JournalRecord, error) {
+	journal, err := journalPath(profile)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(journal)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := make([]JournalRecord, 0)
+	scanner := bufio.NewScanner(f)
+	// a record holds every document deleted by a nuke
+	scanner.Buffer(nil, 1<<30)
+	for scanner.Scan() {
+		var record JournalRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("corrupt journal %s: %v", journal, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// journalEntries returns the documents that differ between the trees old and new
+func journalEntries(old, new *HashTree) []JournalEntry {
+	oldDocs := docsById(old)
+	newDocs := docsById(new)
+
+	entries := make([]JournalEntry, 0)
+	for _, d := range old.Docs {
+		n, ok := newDocs[d.DocumentID]
+		if !ok {
+			entries = append(entries, JournalEntry{ID: d.DocumentID, Before: d})
+		} else if n.Hash != d.Hash {
+			entries = append(entries, JournalEntry{ID: d.DocumentID, Before: d, After: n})
+		}
+	}
+	for _, d := range new.Docs {
+		if _, ok := oldDocs[d.DocumentID]; !ok {
+			entries = append(entries, JournalEntry{ID: d.DocumentID, After: d})
+		}
+	}
+	return entries
+}
+
+// sync runs the operation through Sync and records the documents it changed in the journal
+func (ctx *ApiCtx) sync(record *JournalRecord, operation func(t *HashTree) error) error {
+	var before *HashTree
+	err := Sync(ctx.blobStorage, ctx.hashTree, ctx.concurrent, func(t *HashTree) error {
+		// the tree is mirrored again when the generation was wrong
+		before = t.Clone()
+		return operation(t)
+	})
+	if err != nil {
+		return err
+	}
+
+	record.Time = time.Now()
+	record.FromGeneration = before.Generation
+	record.ToGeneration = ctx.hashTree.Generation
+	// the documents of the tree are changed in place, they are copied before being recorded
+	record.Entries = journalEntries(before, ctx.hashTree.Clone())
+	if ctx.hashTree.dryRun {
+		return nil
+	}
+	if err = appendJournal(ctx.hashTree.profile, record); err != nil {
+		// the operation is done, only its record is missing
+		log.Warning.Println("failed to write the journal:", err)
+	}
+	return nil
+}
+
+// Undo reverts the last n operations of the journal not undone yet, the latest first.
+// An operation is only undone when the documents it changed are still as it left them.
+// The records of the undo operations are returned.
+func (ctx *ApiCtx) Undo(n int) ([]JournalRecord, error) {
+	records, err := ReadJournal(ctx.hashTree.profile)
+	if err != nil {
+		return nil, err
+	}
+
+	undone := make(map[int64]bool)
+	for _, r := range records {
+		if r.Undoes != 0 {
+			undone[r.Undoes] = true
+		}
+	}
+	todo := make([]JournalRecord, 0, n)
+	for i := len(records) - 1; i >= 0 && len(todo) < n; i-- {
+		if r := records[i]; r.Undoes == 0 && !undone[r.ToGeneration] {
+			todo = append(todo, r)
+		}
+	}
+	if len(todo) == 0 {
+		return nil, errors.New("nothing to undo")
+	}
+
+	done := make([]JournalRecord, 0, len(todo))
+	for _, r := range todo {
+		r := r
+		undo := &JournalRecord{Operation: "undo " + r.Operation, Undoes: r.ToGeneration}
+		err = ctx.sync(undo, func(t *HashTree) error {
+			return revert(t, &r)
+		})
+		if err != nil {
+			break
+		}
+		done = append(done, *undo)
+	}
+
+	ctx.ft = DocumentsFileTree(ctx.hashTree)
+	if len(done) > 0 {
+		if syncErr := ctx.SyncComplete(); err == nil {
+			err = syncErr
+		}
+	}
+	return done, err
+}
+
+// revert puts back the documents changed by the operation of a record
+func revert(t *HashTree, r *JournalRecord) error {
+	for _, e := range r.Entries {
+		current, _ := t.FindDoc(e.ID)
+		if (e.After == nil) != (current == nil) || (current != nil && current.Hash != e.After.Hash) {
+			name := e.ID
+			if current != nil {
+				name = current.Metadata.DocName
+			}
+			return fmt.Errorf("can't undo %q (generation %d), %s changed since", r.Operation, r.ToGeneration, name)
+		}
+	}
+
+	for _, e := range r.Entries {
+		if e.After != nil {
+			if err := t.Remove(e.ID); err != nil {
+				return err
+			}
+		}
+		if e.Before != nil {
+			t.Docs = append(t.Docs, e.Before.clone())
+		}
+	}
+	return t.Rehash()
+}
@@ -0,0 +1,72 @@
+package sync15
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUndo(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "rmapi.conf")
+	if err := os.WriteFile(configFile, []byte("cachedir: "+dir+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RMAPI_CONFIG", configFile)
+
+	ctx, _ := newMemCtx(t)
+	original := ctx.hashTree.Hash
+
+	doc := ctx.Filetree().NodeById("doc")
+	if _, err := ctx.MoveEntry(doc, ctx.Filetree().Root(), "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	ctx.ft = DocumentsFileTree(ctx.hashTree)
+	if err := ctx.DeleteEntry(ctx.Filetree().NodeById("folder")); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ReadJournal("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "mv novel renamed", records[0].Operation)
+		assert.Equal(t, int64(7), records[0].FromGeneration)
+		assert.Equal(t, int64(8), records[0].ToGeneration)
+		if assert.Len(t, records[0].Entries, 1) {
+			assert.Equal(t, "folder", records[0].Entries[0].Before.Metadata.Parent)
+			assert.Equal(t, "", records[0].Entries[0].After.Metadata.Parent)
+		}
+		assert.Equal(t, "rm Books", records[1].Operation)
+		if assert.Len(t, records[1].Entries, 1) {
+			assert.Nil(t, records[1].Entries[0].After)
+		}
+	}
+
+	undone, err := ctx.Undo(1)
+	if assert.NoError(t, err) && assert.Len(t, undone, 1) {
+		assert.Equal(t, "undo rm Books", undone[0].Operation)
+		assert.Equal(t, int64(9), undone[0].Undoes)
+	}
+	assert.NotNil(t, ctx.Filetree().NodeById("folder"))
+
+	undone, err = ctx.Undo(5)
+	assert.NoError(t, err)
+	assert.Len(t, undone, 1)
+	assert.Equal(t, original, ctx.hashTree.Hash)
+	novel, err := ctx.hashTree.FindDoc("doc")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "novel", novel.Metadata.DocName)
+		assert.Equal(t, "folder", novel.Metadata.Parent)
+	}
+
+	_, err = ctx.Undo(1)
+	assert.Error(t, err)
+
+	records, err = ReadJournal("")
+	assert.NoError(t, err)
+	assert.Len(t, records, 4)
+}
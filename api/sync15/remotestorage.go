@@ -11,3 +11,11 @@ type RemoteStorageWriter interface {
 	UpdateRootIndex(hash string, generation int64) (gen int64, err error)
 	GetWriter(hash string, writer io.WriteCloser) error
 }
+
+// BlobStore is the storage of the blobs and the root index of an account
+type BlobStore interface {
+	RemoteStorage
+	UploadBlob(hash string, reader io.Reader) error
+	WriteRootIndex(roothash string, gen int64) (int64, error)
+	SyncComplete(gen int64) error
+}
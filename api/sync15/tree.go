@@ -2,20 +2,31 @@ package sync15
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/juruen/rmapi/log"
 	"golang.org/x/sync/errgroup"
 )
 
-const SchemaVersion = "3"
+const SchemaVersion3 = "3"
+
+// SchemaVersion4 indexes start with a header line with the number of entries and their total size,
+// and are hashed as a whole
+const SchemaVersion4 = "4"
+
+// SchemaVersion is the schema used when the account has no index yet
+const SchemaVersion = SchemaVersion3
+
 const DocType = "80000000"
 const FileType = "0"
 const Delimiter = ':'
@@ -75,42 +86,87 @@ func parseEntry(line string) (*Entry, error) {
 	return &entry, nil
 }
 
-func parseIndex(f io.Reader) ([]*Entry, error) {
+func parseIndex(f io.Reader) (string, []*Entry, error) {
 	var entries []*Entry
 	scanner := bufio.NewScanner(f)
 	scanner.Scan()
 	schema := scanner.Text()
 
-	if schema != SchemaVersion {
-		return nil, errors.New("wrong schema")
+	switch schema {
+	case SchemaVersion3:
+	case SchemaVersion4:
+		scanner.Scan()
+		header := NewFieldReader(scanner.Text())
+		if len(header.fields) != 4 || header.fields[0] != "0" {
+			return "", nil, fmt.Errorf("wrong index header '%s'", scanner.Text())
+		}
+	default:
+		return "", nil, errors.New("wrong schema")
 	}
+
 	for scanner.Scan() {
 		line := scanner.Text()
 		entry, err := parseEntry(line)
 		if err != nil {
-			return nil, fmt.Errorf("cant parse line '%s', %w", line, err)
+			return "", nil, fmt.Errorf("cant parse line '%s', %w", line, err)
 		}
 
 		entries = append(entries, entry)
 	}
-	return entries, nil
+	return schema, entries, nil
 }
 
-func (t *HashTree) IndexReader() (io.ReadCloser, error) {
-	pipeReader, pipeWriter := io.Pipe()
-	w := bufio.NewWriter(pipeWriter)
-	go func() {
-		defer pipeWriter.Close()
-		w.WriteString(SchemaVersion)
-		w.WriteString("\n")
-		for _, d := range t.Docs {
-			w.WriteString(d.Line())
-			w.WriteString("\n")
-		}
-		w.Flush()
-	}()
+// indexContent builds an index file with the given lines.
+// id is the document the index belongs to, "." for the root index.
+func indexContent(schema, id string, lines []string, size int64) []byte {
+	var sb strings.Builder
+	schema = schemaOrDefault(schema)
+	sb.WriteString(schema)
+	sb.WriteString("\n")
+	if schema == SchemaVersion4 {
+		sb.WriteString(fmt.Sprintf("0%c%s%c%d%c%d\n", Delimiter, id, Delimiter, len(lines), Delimiter, size))
+	}
+	for _, l := range lines {
+		sb.WriteString(l)
+		sb.WriteString("\n")
+	}
+	return []byte(sb.String())
+}
+
+// hashIndex returns the hash of an index: the hash of its content in schema 4
+// or the hash of the hashes of its entries otherwise
+func hashIndex(schema string, content []byte, entries []*Entry) (string, error) {
+	if schemaOrDefault(schema) == SchemaVersion4 {
+		hash := sha256.Sum256(content)
+		return hex.EncodeToString(hash[:]), nil
+	}
 
-	return pipeReader, nil
+	return HashEntries(entries)
+}
+
+func schemaOrDefault(schema string) string {
+	if schema == "" {
+		return SchemaVersion
+	}
+	return schema
+}
+
+func (t *HashTree) indexContent() []byte {
+	docs := append([]*BlobDoc{}, t.Docs...)
+	sort.Slice(docs, func(i, j int) bool { return docs[i].DocumentID < docs[j].DocumentID })
+
+	lines := make([]string, 0, len(docs))
+	var size int64
+	for _, d := range docs {
+		lines = append(lines, d.Line())
+		size += d.filesSize()
+	}
+
+	return indexContent(t.SchemaVersion, ".", lines, size)
+}
+
+func (t *HashTree) IndexReader() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(t.indexContent())), nil
 }
 
 type HashTree struct {
@@ -118,6 +174,12 @@ type HashTree struct {
 	Generation   int64
 	Docs         []*BlobDoc
 	CacheVersion int
+	// SchemaVersion is the schema of the root index of the account
+	SchemaVersion string
+	// profile is the account the tree is cached for
+	profile string
+	// dryRun trees are copies that are never cached
+	dryRun bool
 }
 
 func (t *HashTree) FindDoc(id string) (*BlobDoc, error) {
@@ -155,7 +217,7 @@ func (t *HashTree) Rehash() error {
 	for _, e := range t.Docs {
 		entries = append(entries, &e.Entry)
 	}
-	hash, err := HashEntries(entries)
+	hash, err := hashIndex(t.SchemaVersion, t.indexContent(), entries)
 	if err != nil {
 		return err
 	}
@@ -188,7 +250,7 @@ func (t *HashTree) Mirror(r RemoteStorage, maxconcurrent int) error {
 	}
 	defer rootIndexReader.Close()
 
-	entries, err := parseIndex(rootIndexReader)
+	schema, entries, err := parseIndex(rootIndexReader)
 	if err != nil {
 		return err
 	}
@@ -251,6 +313,7 @@ EXIT:
 	t.Docs = head
 	t.Generation = gen
 	t.Hash = rootHash
+	t.SchemaVersion = schema
 	return nil
 }
 
@@ -271,7 +334,8 @@ func BuildTree(provider RemoteStorage) (*HashTree, error) {
 	}
 
 	defer rootIndex.Close()
-	entries, _ := parseIndex(rootIndex)
+	schema, entries, _ := parseIndex(rootIndex)
+	tree.SchemaVersion = schema
 
 	for _, e := range entries {
 		f, _ := provider.GetReader(e.Hash)
@@ -280,7 +344,8 @@ func BuildTree(provider RemoteStorage) (*HashTree, error) {
 		doc := &BlobDoc{}
 		doc.Entry = *e
 
-		items, _ := parseIndex(f)
+		docSchema, items, _ := parseIndex(f)
+		doc.SchemaVersion = docSchema
 		doc.Files = items
 		for _, i := range items {
 			doc.ReadMetadata(i, provider)
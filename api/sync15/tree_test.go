@@ -1,6 +1,8 @@
 package sync15
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"strings"
 	"testing"
@@ -29,7 +31,7 @@ func TestParseIndex(t *testing.T) {
 	index := `3
 	0f83178c4ebe6a60fae0360b74916ee9e1faa5de1c56ab3481eccdc5cb98754f:0:fe0039fb-56a0-4561-a36f-a820f0009622.content:0:993
 	17eca6c9a540c993f5f5506bb09b7a40993c02fa8f065b1a6a442e412cf2fd04:0:fe0039fb-56a0-4561-a36f-a820f0009622.metadata:0:320`
-	entries, err := parseIndex(strings.NewReader(index))
+	schema, entries, err := parseIndex(strings.NewReader(index))
 	if err != nil {
 		t.Error(err)
 		return
@@ -38,6 +40,27 @@ func TestParseIndex(t *testing.T) {
 		t.Error("wrong number of entries")
 		return
 	}
+	if schema != SchemaVersion3 {
+		t.Error("wrong schema")
+	}
+}
+
+func TestParseIndexV4(t *testing.T) {
+	index := `4
+0:.:2:1313
+0f83178c4ebe6a60fae0360b74916ee9e1faa5de1c56ab3481eccdc5cb98754f:0:fe0039fb-56a0-4561-a36f-a820f0009622.content:0:993
+17eca6c9a540c993f5f5506bb09b7a40993c02fa8f065b1a6a442e412cf2fd04:0:fe0039fb-56a0-4561-a36f-a820f0009622.metadata:0:320`
+	schema, entries, err := parseIndex(strings.NewReader(index))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if schema != SchemaVersion4 {
+		t.Error("wrong schema")
+	}
+	if len(entries) != 2 || entries[1].Size != 320 {
+		t.Error("wrong entries")
+	}
 }
 
 func TestCreateDocIndex(t *testing.T) {
@@ -105,3 +128,53 @@ e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855:80000000:someid
 	}
 
 }
+
+func TestCreateIndexV4(t *testing.T) {
+	tree := HashTree{SchemaVersion: SchemaVersion4}
+	doc := &BlobDoc{
+		Entry: Entry{
+			DocumentID: "someid"},
+		SchemaVersion: SchemaVersion4,
+	}
+	doc.AddFile(&Entry{Hash: "blah", DocumentID: "someid.content", Size: 10})
+	doc.AddFile(&Entry{Hash: "bleh", DocumentID: "someid.metadata", Size: 5})
+	tree.Add(doc)
+
+	reader, err := doc.IndexReader()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	index, _ := io.ReadAll(reader)
+	expected := `4
+0:someid:2:15
+blah:0:someid.content:0:10
+bleh:0:someid.metadata:0:5
+`
+	if string(index) != expected {
+		t.Errorf("index did not match %s", index)
+	}
+	hash := sha256.Sum256(index)
+	if doc.Hash != hex.EncodeToString(hash[:]) {
+		t.Error("doc hash is not the hash of its index")
+	}
+
+	reader, err = tree.IndexReader()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	index, _ = io.ReadAll(reader)
+	expected = "4\n0:.:1:15\n" + doc.Hash + ":80000000:someid:2:15\n"
+	if string(index) != expected {
+		t.Errorf("index did not match %s", index)
+	}
+	hash = sha256.Sum256(index)
+	if tree.Hash != hex.EncodeToString(hash[:]) {
+		t.Error("root hash is not the hash of its index")
+	}
+
+	if err := tree.Add(&BlobDoc{Files: []*Entry{{}}}); err == nil {
+		t.Error("a schema 3 document was added to a schema 4 tree")
+	}
+}
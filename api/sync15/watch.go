@@ -0,0 +1,199 @@
+package sync15
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChangeType is the kind of a Change
+type ChangeType string
+
+const (
+	ChangeAdded    ChangeType = "added"
+	ChangeModified ChangeType = "modified"
+	ChangeMoved    ChangeType = "moved"
+	ChangeRenamed  ChangeType = "renamed"
+	ChangeDeleted  ChangeType = "deleted"
+)
+
+// Change is a document or a directory that differs between two trees
+type Change struct {
+	Type ChangeType `json:"type"`
+	ID   string     `json:"id"`
+	Name string     `json:"name"`
+	// DocType is DocumentType or CollectionType
+	DocType string `json:"docType"`
+	// Path is the path in the new tree, or in the old one for a deleted entry
+	Path string `json:"path"`
+	// OldPath is the path before a move or a rename
+	OldPath string `json:"oldPath,omitempty"`
+	// Files are the files added, changed or removed in a modified document,
+	// e.g. the pages with new annotations
+	Files []string `json:"files,omitempty"`
+	// Pages are the page changes of a modified document, when asked for
+	Pages      *PageChanges `json:"pages,omitempty"`
+	Generation int64        `json:"generation"`
+	Time       time.Time    `json:"time"`
+}
+
+// Clone returns a copy of the tree that isn't changed when the tree is mirrored
+func (t *HashTree) Clone() *HashTree {
+	clone := *t
+	clone.Docs = make([]*BlobDoc, 0, len(t.Docs))
+	for _, d := range t.Docs {
+		clone.Docs = append(clone.Docs, d.clone())
+	}
+
+	return &clone
+}
+
+// clone returns a copy of the document and of its files
+func (d *BlobDoc) clone() *BlobDoc {
+	doc := *d
+	doc.Files = make([]*Entry, 0, len(d.Files))
+	for _, f := range d.Files {
+		file := *f
+		doc.Files = append(doc.Files, &file)
+	}
+	return &doc
+}
+
+// DiffTrees returns the changes from the tree old to the tree new.
+// A document is modified when its files change, changes of the metadata alone,
+// like the last opened page, are ignored. An entry is moved when its parent changes,
+// and renamed when only its name changes.
+func DiffTrees(old, new *HashTree) []Change {
+	oldDocs := docsById(old)
+	newDocs := docsById(new)
+	now := time.Now()
+
+	changes := make([]Change, 0)
+	change := func(t ChangeType, d *BlobDoc, docs map[string]*BlobDoc) Change {
+		return Change{
+			Type:       t,
+			ID:         d.DocumentID,
+			Name:       d.Metadata.DocName,
+			DocType:    d.Metadata.CollectionType,
+			Path:       docPath(docs, d.DocumentID),
+			Generation: new.Generation,
+			Time:       now,
+		}
+	}
+
+	for id, d := range newDocs {
+		o, ok := oldDocs[id]
+		if !ok {
+			changes = append(changes, change(ChangeAdded, d, newDocs))
+			continue
+		}
+
+		if o.Metadata.Parent != d.Metadata.Parent {
+			c := change(ChangeMoved, d, newDocs)
+			c.OldPath = docPath(oldDocs, id)
+			changes = append(changes, c)
+		} else if o.Metadata.DocName != d.Metadata.DocName {
+			c := change(ChangeRenamed, d, newDocs)
+			c.OldPath = docPath(oldDocs, id)
+			changes = append(changes, c)
+		}
+
+		if o.Hash == d.Hash {
+			continue
+		}
+		if files := changedFiles(o, d); len(files) > 0 {
+			c := change(ChangeModified, d, newDocs)
+			c.Files = files
+			changes = append(changes, c)
+		}
+	}
+
+	for id, o := range oldDocs {
+		if _, ok := newDocs[id]; !ok {
+			changes = append(changes, change(ChangeDeleted, o, oldDocs))
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func docsById(t *HashTree) map[string]*BlobDoc {
+	docs := make(map[string]*BlobDoc, len(t.Docs))
+	for _, d := range t.Docs {
+		docs[d.DocumentID] = d
+	}
+	return docs
+}
+
+// changedFiles returns the files, other than the metadata, that differ between two versions of a document
+func changedFiles(old, new *BlobDoc) []string {
+	hashes := make(map[string]string)
+	for _, f := range old.Files {
+		hashes[f.DocumentID] = f.Hash
+	}
+
+	files := make([]string, 0)
+	for _, f := range new.Files {
+		hash, ok := hashes[f.DocumentID]
+		delete(hashes, f.DocumentID)
+		if (!ok || hash != f.Hash) && !strings.HasSuffix(f.DocumentID, ".metadata") {
+			files = append(files, f.DocumentID)
+		}
+	}
+	for id := range hashes {
+		if !strings.HasSuffix(id, ".metadata") {
+			files = append(files, id)
+		}
+	}
+
+	sort.Strings(files)
+	return files
+}
+
+// docPath returns the path of the document id, the documents in the trash are under /trash
+func docPath(docs map[string]*BlobDoc, id string) string {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for id != "" && !seen[id] {
+		seen[id] = true
+		if id == trashId {
+			names = append(names, trashId)
+			break
+		}
+		d, ok := docs[id]
+		if !ok {
+			break
+		}
+		names = append(names, d.Metadata.DocName)
+		id = d.Metadata.Parent
+	}
+
+	var sb strings.Builder
+	for i := len(names) - 1; i >= 0; i-- {
+		sb.WriteString("/")
+		sb.WriteString(names[i])
+	}
+	return sb.String()
+}
+
+// Changes checks the generation of the account and, when it changed, mirrors the
+// tree and returns what changed since the last call
+func (ctx *ApiCtx) Changes() ([]Change, error) {
+	rootHash, _, err := ctx.blobStorage.GetRootIndex()
+	if err != nil {
+		return nil, err
+	}
+	if rootHash == ctx.hashTree.Hash {
+		return nil, nil
+	}
+
+	old := ctx.hashTree.Clone()
+	if err = ctx.hashTree.Mirror(ctx.blobStorage, ctx.concurrent); err != nil {
+		return nil, err
+	}
+	saveTree(ctx.hashTree)
+	ctx.ft = DocumentsFileTree(ctx.hashTree)
+
+	return DiffTrees(old, ctx.hashTree), nil
+}
@@ -0,0 +1,96 @@
+package sync15
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/juruen/rmapi/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDoc(id, name, parent, colType string, files ...*Entry) *BlobDoc {
+	d := NewBlobDoc(name, id, colType, parent)
+	d.Hash = id
+	d.Files = files
+	return d
+}
+
+func TestDiffTrees(t *testing.T) {
+	old := &HashTree{Docs: []*BlobDoc{
+		testDoc("books", "Books", "", model.DirectoryType),
+		testDoc("novel", "novel", "books", model.DocumentType, &Entry{DocumentID: "novel/p1.rm", Hash: "a"}),
+		testDoc("notes", "notes", "", model.DocumentType),
+		testDoc("old", "old", "", model.DocumentType),
+		testDoc("draft", "draft", "books", model.DocumentType),
+	}}
+
+	new := old.Clone()
+	new.Generation = 2
+	novel, _ := new.FindDoc("novel")
+	novel.Hash = "changed"
+	novel.Files[0].Hash = "b"
+	novel.Files = append(novel.Files, &Entry{DocumentID: "novel/p2.rm", Hash: "c"})
+	notes, _ := new.FindDoc("notes")
+	notes.Metadata.Parent = trashId
+	draft, _ := new.FindDoc("draft")
+	draft.Metadata.DocName = "final"
+	assert.NoError(t, new.Remove("old"))
+	new.Docs = append(new.Docs, testDoc("paper", "paper", "books", model.DocumentType))
+
+	// the clone is a copy
+	original, _ := old.FindDoc("novel")
+	assert.Equal(t, "a", original.Files[0].Hash)
+
+	changes := DiffTrees(old, new)
+	assert.Len(t, changes, 5)
+
+	byType := make(map[ChangeType]Change)
+	for _, c := range changes {
+		byType[c.Type] = c
+		assert.Equal(t, int64(2), c.Generation)
+	}
+	assert.Equal(t, "/Books/paper", byType[ChangeAdded].Path)
+	assert.Equal(t, []string{"novel/p1.rm", "novel/p2.rm"}, byType[ChangeModified].Files)
+	assert.Equal(t, "/Books/novel", byType[ChangeModified].Path)
+	assert.Equal(t, "/trash/notes", byType[ChangeMoved].Path)
+	assert.Equal(t, "/notes", byType[ChangeMoved].OldPath)
+	assert.Equal(t, "/old", byType[ChangeDeleted].Path)
+	assert.Equal(t, "/Books/final", byType[ChangeRenamed].Path)
+	assert.Equal(t, "/Books/draft", byType[ChangeRenamed].OldPath)
+}
+
+func TestSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "rmapi.conf")
+	if err := os.WriteFile(configFile, []byte("cachedir: "+dir+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("RMAPI_CONFIG", configFile)
+
+	tree := &HashTree{Docs: []*BlobDoc{testDoc("notes", "notes", "", model.DocumentType)}}
+	for gen := int64(1); gen <= historySize+2; gen++ {
+		tree.Generation = gen
+		assert.NoError(t, saveTree(tree))
+	}
+
+	gens, err := snapshots("")
+	assert.NoError(t, err)
+	assert.Len(t, gens, historySize)
+	assert.Equal(t, int64(3), gens[0])
+
+	snapshot, _, err := loadSnapshot("", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), snapshot.Generation)
+	assert.Len(t, snapshot.Docs, 1)
+
+	_, _, err = loadSnapshot("", 1)
+	assert.Error(t, err)
+
+	gen, err := snapshotAt("", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(historySize+2), gen)
+	_, err = snapshotAt("", time.Now().Add(-time.Hour))
+	assert.Error(t, err)
+}
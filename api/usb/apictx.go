@@ -0,0 +1,270 @@
+// Package usb implements the API on the web interface the tablet offers
+// when it is connected over USB. It needs no account but only supports
+// listing, downloading and uploading documents.
+package usb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/juruen/rmapi/archive"
+	"github.com/juruen/rmapi/convert"
+	"github.com/juruen/rmapi/filetree"
+	"github.com/juruen/rmapi/log"
+	"github.com/juruen/rmapi/model"
+	"github.com/juruen/rmapi/util"
+)
+
+// DefaultHost is the address of the tablet connected over USB
+const DefaultHost = "http://10.11.99.1"
+
+// ErrNotSupported is returned for the operations the web interface doesn't offer
+var ErrNotSupported = errors.New("not supported by the USB web interface")
+
+// An ApiCtx allows you to interact with the USB web interface of the tablet
+type ApiCtx struct {
+	host   string
+	client *http.Client
+	ft     *filetree.FileTreeCtx
+}
+
+// CreateCtx reads the documents of the tablet found at host
+func CreateCtx(host string) (*ApiCtx, error) {
+	ctx := &ApiCtx{
+		host:   strings.TrimSuffix(host, "/"),
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+
+	if err := ctx.Refresh(); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+func (ctx *ApiCtx) Filetree() *filetree.FileTreeCtx {
+	return ctx.ft
+}
+
+// Refresh lists all the documents again
+func (ctx *ApiCtx) Refresh() error {
+	fileTree := filetree.CreateFileTreeCtx()
+
+	pending := []string{""}
+	for len(pending) > 0 {
+		parentId := pending[0]
+		pending = pending[1:]
+
+		documents, err := ctx.list(parentId)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range documents {
+			// the listing doesn't always include the parent
+			if d.Parent == "" {
+				d.Parent = parentId
+			}
+			fileTree.AddDocument(d)
+			if d.Type == model.DirectoryType {
+				pending = append(pending, d.ID)
+			}
+		}
+	}
+
+	ctx.ft = &fileTree
+	return nil
+}
+
+// FetchDocument downloads the pdf of a document, with its annotations, and saves it
+// into dstPath as an archive so that it can be used as the ones of the cloud
+func (ctx *ApiCtx) FetchDocument(docId, dstPath string) error {
+	rsp, err := ctx.request(http.MethodGet, "/download/"+docId+"/placeholder", "", nil)
+	if err != nil {
+		log.Error.Println("failed to download document", err)
+		return err
+	}
+	defer rsp.Body.Close()
+
+	payload, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+
+	z := archive.NewZip()
+	z.UUID = docId
+	z.Content.FileType = util.PDF
+	z.Payload = payload
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	return z.Write(dst)
+}
+
+// UploadDocument uploads a local document given by sourceDocPath under the parentId directory.
+// Only pdf and epub documents, or files converted to them, can be uploaded.
+func (ctx *ApiCtx) UploadDocument(parentId string, sourceDocPath string, notify bool) (*model.Document, error) {
+	name, ext := util.DocPathToName(sourceDocPath)
+
+	if name == "" {
+		return nil, errors.New("file name is invalid")
+	}
+
+	if !util.IsFileTypeSupported(ext) {
+		return nil, errors.New("unsupported file extension: " + ext)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "rmupload")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	sourceDocPath, ext, err = convert.Prepare(sourceDocPath, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := map[string]string{util.PDF: "application/pdf", util.EPUB: "application/epub+zip"}[ext]
+	if contentType == "" {
+		return nil, fmt.Errorf("%s files can't be uploaded over USB", ext)
+	}
+
+	// the web interface uploads to the last listed directory
+	existing, err := ctx.list(parentId)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, d := range existing {
+		known[d.ID] = true
+	}
+
+	src, err := os.Open(sourceDocPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s.%s"`, strings.ReplaceAll(name, `"`, "'"), ext))
+	header.Set("Content-Type", contentType)
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = io.Copy(part, src); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	rsp, err := ctx.request(http.MethodPost, "/upload", w.FormDataContentType(), &body)
+	if err != nil {
+		log.Error.Println("failed to upload document", err)
+		return nil, err
+	}
+	rsp.Body.Close()
+
+	// the response doesn't say which id the document got, look for it
+	documents, err := ctx.list(parentId)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range documents {
+		if !known[d.ID] && d.VissibleName == name {
+			if d.Parent == "" {
+				d.Parent = parentId
+			}
+			return d, nil
+		}
+	}
+
+	return nil, errors.New("the document was uploaded but can't be found")
+}
+
+// CreateDir is not supported
+func (ctx *ApiCtx) CreateDir(parentId, name string, notify bool) (*model.Document, error) {
+	return nil, ErrNotSupported
+}
+
+// ReplaceDocument is not supported
+func (ctx *ApiCtx) ReplaceDocument(docId string, sourceZipPath string, notify bool) (*model.Document, error) {
+	return nil, ErrNotSupported
+}
+
+// MoveEntry is not supported
+func (ctx *ApiCtx) MoveEntry(src, dstDir *model.Node, name string) (*model.Node, error) {
+	return nil, ErrNotSupported
+}
+
+// DeleteEntry is not supported
+func (ctx *ApiCtx) DeleteEntry(node *model.Node) error {
+	return ErrNotSupported
+}
+
+// Nuke is not supported
+func (ctx *ApiCtx) Nuke() error {
+	return ErrNotSupported
+}
+
+// SyncComplete does nothing for the web interface
+func (ctx *ApiCtx) SyncComplete() error {
+	return nil
+}
+
+// list returns the entries of the directory parentId, it also makes it the
+// destination of the next upload
+func (ctx *ApiCtx) list(parentId string) ([]*model.Document, error) {
+	rsp, err := ctx.request(http.MethodGet, "/documents/"+parentId, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	documents := make([]*model.Document, 0)
+	if err = json.NewDecoder(rsp.Body).Decode(&documents); err != nil {
+		return nil, fmt.Errorf("can't read the document list: %v", err)
+	}
+
+	return documents, nil
+}
+
+func (ctx *ApiCtx) request(method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, ctx.host+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	log.Trace.Println(method, req.URL)
+	rsp, err := ctx.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("can't reach the tablet, is the USB web interface enabled? %v", err)
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		rsp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", method, path, rsp.Status)
+	}
+
+	return rsp, nil
+}
@@ -0,0 +1,120 @@
+package usb
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/juruen/rmapi/archive"
+	"github.com/juruen/rmapi/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// tablet stands in for the web interface, uploads go to the last listed folder
+type tablet struct {
+	entries map[string][]map[string]interface{}
+	current string
+	files   map[string][]byte
+}
+
+func (tb *tablet) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/documents/"):
+		tb.current = strings.TrimPrefix(r.URL.Path, "/documents/")
+		entries := tb.entries[tb.current]
+		if entries == nil {
+			entries = []map[string]interface{}{}
+		}
+		json.NewEncoder(w).Encode(entries)
+	case strings.HasPrefix(r.URL.Path, "/download/"):
+		id := strings.Split(r.URL.Path, "/")[2]
+		data, ok := tb.files[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	case r.URL.Path == "/upload" && r.Method == http.MethodPost:
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		id := "uploaded"
+		name := strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+		tb.entries[tb.current] = append(tb.entries[tb.current], map[string]interface{}{
+			"ID": id, "VissibleName": name, "Type": "DocumentType", "Parent": tb.current,
+		})
+		tb.files[id] = data
+		w.Write([]byte("{}"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestUsb(t *testing.T) {
+	pdf, err := os.ReadFile("../../archive/zipdoc_test.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tb := &tablet{
+		entries: map[string][]map[string]interface{}{
+			"": {
+				{"ID": "folder", "VissibleName": "Books", "Type": "CollectionType"},
+				{"ID": "doc", "VissibleName": "paper", "Type": "DocumentType"},
+			},
+			"folder": {
+				{"ID": "inner", "VissibleName": "novel", "Type": "DocumentType", "Parent": "folder"},
+			},
+		},
+		files: map[string][]byte{"doc": pdf},
+	}
+	server := httptest.NewServer(tb)
+	defer server.Close()
+
+	ctx, err := CreateCtx(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := ctx.Filetree().NodeByPath("/Books/novel", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "inner", node.Document.ID)
+
+	zipPath := filepath.Join(t.TempDir(), "paper.zip")
+	if err = ctx.FetchDocument("doc", zipPath); err != nil {
+		t.Fatal(err)
+	}
+	payload := filepath.Join(t.TempDir(), "paper.pdf")
+	if err = archive.ReadPayload(zipPath, payload); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(payload)
+	assert.Equal(t, pdf, data)
+
+	src := filepath.Join(t.TempDir(), "book.pdf")
+	if _, err = util.CopyFile("../../archive/zipdoc_test.pdf", src); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := ctx.UploadDocument("folder", src, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "uploaded", doc.ID)
+	assert.Equal(t, "book", doc.VissibleName)
+	assert.Equal(t, "folder", doc.Parent)
+	assert.Equal(t, pdf, tb.files["uploaded"])
+
+	_, err = ctx.MoveEntry(node, ctx.Filetree().Root(), "moved")
+	assert.Equal(t, ErrNotSupported, err)
+	assert.Equal(t, ErrNotSupported, ctx.DeleteEntry(node))
+}
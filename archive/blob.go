@@ -69,8 +69,22 @@ func Prepare(name, parentId, sourceDocPath, ext, tmpDir string) (files *Document
 		if ext == util.RM {
 			pageId := uuid.New().String()
 			objectName = fmt.Sprintf("%s/%s.rm", id, pageId)
-			doctype = "notebook"
+			doctype = NotebookType
 			pageIds = []string{pageId}
+
+			pageName, pagePath, err1 := CreatePageMetadata(id, pageId, tmpDir)
+			if err1 != nil {
+				err = err1
+				return
+			}
+			files.AddMap(pageName, pagePath)
+
+			pageName, pagePath, err1 = CreatePagedata(id, []string{defaultPagadata}, tmpDir)
+			if err1 != nil {
+				err = err1
+				return
+			}
+			files.AddMap(pageName, pagePath)
 		}
 		files.AddMap(objectName, sourceDocPath)
 		objectName, filePath, err1 := CreateMetadata(id, name, parentId, model.DocumentType, tmpDir)
@@ -0,0 +1,285 @@
+package archive
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentFormatV2 is the .content format where the pages are listed in CPages
+const ContentFormatV2 = 2
+
+// authorId identifies the changes made by rmapi in the timestamps of CPages
+const authorId = "8d6ea1f5-7f5b-4d1e-9c1f-3a0a4b6e2f71"
+
+// CPages is the page list of a v2 .content. Every field is a CRDT value,
+// the one with the newest timestamp wins when the tablet merges two versions.
+type CPages struct {
+	LastOpened CrdtString `json:"lastOpened"`
+	// Original is the number of pages of the payload, -1 for notebooks
+	Original CrdtInt     `json:"original"`
+	Pages    []CPage     `json:"pages"`
+	Uuids    []CPageUUID `json:"uuids"`
+}
+
+// CPage is a page of a v2 .content
+type CPage struct {
+	Id string `json:"id"`
+	// Idx sorts the pages
+	Idx CrdtString `json:"idx"`
+	// Redir is the page of the payload, nil for inserted pages
+	Redir    *CrdtInt    `json:"redir,omitempty"`
+	Template *CrdtString `json:"template,omitempty"`
+	// Deleted is not zero when the page was removed
+	Deleted *CrdtInt `json:"deleted,omitempty"`
+	// Modified is the last modification in milliseconds, the typo is in the format
+	Modified       string      `json:"modifed,omitempty"`
+	ScrollTime     *CrdtString `json:"scrollTime,omitempty"`
+	VerticalScroll *CrdtFloat  `json:"verticalScroll,omitempty"`
+}
+
+// CPageUUID maps the UUID of an author to the number used in timestamps
+type CPageUUID struct {
+	First  string `json:"first"`
+	Second int    `json:"second"`
+}
+
+// CrdtString is a string value of CPages
+type CrdtString struct {
+	Timestamp string `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// CrdtInt is an integer value of CPages
+type CrdtInt struct {
+	Timestamp string `json:"timestamp"`
+	Value     int    `json:"value"`
+}
+
+// CrdtFloat is a float value of CPages
+type CrdtFloat struct {
+	Timestamp string  `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// Tag is a tag of the document
+type Tag struct {
+	Name      string `json:"name"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// PageTag is a tag of a page
+type PageTag struct {
+	Name      string `json:"name"`
+	PageId    string `json:"pageId"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// IsDeleted tells whether the page was removed
+func (p *CPage) IsDeleted() bool {
+	return p.Deleted != nil && p.Deleted.Value != 0
+}
+
+// DocumentPages returns the ids of the pages in order, the page of the payload
+// each of them shows (-1 for inserted pages) and their templates if known.
+// It reads either the CPages of a v2 .content or the legacy page list.
+func (c *Content) DocumentPages() (ids []string, redirection []int, templates []string) {
+	if c.CPages == nil {
+		ids = c.Pages
+		redirection = make([]int, len(c.Pages))
+		for i := range redirection {
+			redirection[i] = i
+			if len(c.RedirectionMap) > 0 {
+				redirection[i] = -1
+				if i < len(c.RedirectionMap) {
+					redirection[i] = c.RedirectionMap[i]
+				}
+			}
+		}
+		return
+	}
+
+	pages := make([]CPage, 0, len(c.CPages.Pages))
+	for _, p := range c.CPages.Pages {
+		if !p.IsDeleted() {
+			pages = append(pages, p)
+		}
+	}
+	sort.SliceStable(pages, func(i, j int) bool {
+		if pages[i].Idx.Value != pages[j].Idx.Value {
+			return pages[i].Idx.Value < pages[j].Idx.Value
+		}
+		return pages[i].Id < pages[j].Id
+	})
+
+	for _, p := range pages {
+		ids = append(ids, p.Id)
+		redir := -1
+		if p.Redir != nil {
+			redir = p.Redir.Value
+		}
+		redirection = append(redirection, redir)
+		template := ""
+		if p.Template != nil {
+			template = p.Template.Value
+		}
+		templates = append(templates, template)
+	}
+
+	return
+}
+
+// SetPages replaces the list of pages. Templates are optional, an empty one keeps
+// the current template. For a v2 .content the pages that are not listed
+// any more are marked as deleted and the changes are timestamped so that they win over
+// the current values.
+func (c *Content) SetPages(ids []string, redirection []int, templates []string) {
+	c.PageCount = len(ids)
+
+	// v2 documents may still have the legacy list
+	if c.CPages == nil || c.Pages != nil {
+		c.Pages = ids
+		c.RedirectionMap = redirection
+	}
+	if c.CPages == nil {
+		return
+	}
+
+	ts := c.CPages.nextTimestamp()
+	current := make(map[string]int)
+	for i, p := range c.CPages.Pages {
+		current[p.Id] = i
+	}
+
+	listed := make(map[string]bool)
+	for i, id := range ids {
+		listed[id] = true
+
+		idx, ok := current[id]
+		if !ok {
+			c.CPages.Pages = append(c.CPages.Pages, CPage{Id: id})
+			idx = len(c.CPages.Pages) - 1
+		}
+		p := &c.CPages.Pages[idx]
+
+		p.Idx = CrdtString{ts, pageIndex(i, len(ids))}
+		if redirection[i] >= 0 {
+			p.Redir = &CrdtInt{ts, redirection[i]}
+		} else {
+			p.Redir = nil
+		}
+		if i < len(templates) && templates[i] != "" {
+			p.Template = &CrdtString{ts, templates[i]}
+		} else if p.Template == nil {
+			p.Template = &CrdtString{ts, defaultPagadata}
+		}
+		if p.IsDeleted() {
+			p.Deleted = &CrdtInt{ts, 0}
+		}
+	}
+
+	for i := range c.CPages.Pages {
+		p := &c.CPages.Pages[i]
+		if !listed[p.Id] && !p.IsDeleted() {
+			p.Deleted = &CrdtInt{ts, 1}
+		}
+	}
+}
+
+// setTemplates updates the templates of the pages of a v2 .content that changed
+func (c *Content) setTemplates(templates []string) {
+	if c.CPages == nil {
+		return
+	}
+
+	ids, _, current := c.DocumentPages()
+	changed := make(map[string]string)
+	for i, id := range ids {
+		if i < len(templates) && templates[i] != "" && templates[i] != current[i] {
+			changed[id] = templates[i]
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	ts := c.CPages.nextTimestamp()
+	for i := range c.CPages.Pages {
+		if t, ok := changed[c.CPages.Pages[i].Id]; ok {
+			c.CPages.Pages[i].Template = &CrdtString{ts, t}
+		}
+	}
+}
+
+// nextTimestamp returns a timestamp newer than any other in the pages,
+// registering rmapi as an author if needed
+func (c *CPages) nextTimestamp() string {
+	author := 0
+	next := 1
+	for _, u := range c.Uuids {
+		if u.First == authorId {
+			author = u.Second
+		}
+		if u.Second >= next {
+			next = u.Second + 1
+		}
+	}
+	if author == 0 {
+		author = next
+		c.Uuids = append(c.Uuids, CPageUUID{authorId, author})
+	}
+
+	counter := timestampCounter(c.LastOpened.Timestamp)
+	if n := timestampCounter(c.Original.Timestamp); n > counter {
+		counter = n
+	}
+	for _, p := range c.Pages {
+		for _, ts := range p.timestamps() {
+			if n := timestampCounter(ts); n > counter {
+				counter = n
+			}
+		}
+	}
+
+	return fmt.Sprintf("%d:%d", author, counter+1)
+}
+
+func (p *CPage) timestamps() []string {
+	ts := []string{p.Idx.Timestamp}
+	if p.Redir != nil {
+		ts = append(ts, p.Redir.Timestamp)
+	}
+	if p.Template != nil {
+		ts = append(ts, p.Template.Timestamp)
+	}
+	if p.Deleted != nil {
+		ts = append(ts, p.Deleted.Timestamp)
+	}
+	return ts
+}
+
+// timestampCounter returns the counter of a timestamp of the form author:counter
+func timestampCounter(ts string) int {
+	parts := strings.Split(ts, ":")
+	n, _ := strconv.Atoi(parts[len(parts)-1])
+	return n
+}
+
+// pageIndex returns a sort key for the page i of count, all keys have the same length
+// so that they sort as strings
+func pageIndex(i, count int) string {
+	width := 1
+	for n := 26; n < count; n *= 26 {
+		width++
+	}
+
+	key := make([]byte, width)
+	for w := width - 1; w >= 0; w-- {
+		key[w] = byte('a' + i%26)
+		i /= 26
+	}
+
+	// keys start with b as the tablet does, so pages can be added before the first one
+	return "b" + string(key)
+}
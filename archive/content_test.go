@@ -0,0 +1,156 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const contentV2 = `{
+    "cPages": {
+        "lastOpened": {"timestamp": "1:1", "value": "p2"},
+        "original": {"timestamp": "1:1", "value": 3},
+        "pages": [
+            {"id": "p2", "idx": {"timestamp": "1:2", "value": "bb"}, "redir": {"timestamp": "1:2", "value": 1}, "template": {"timestamp": "1:1", "value": "P Grid medium"}},
+            {"id": "p1", "idx": {"timestamp": "1:2", "value": "ba"}, "redir": {"timestamp": "1:2", "value": 0}},
+            {"id": "0b7ac2f4-3c1e-4b8e-9a52-6d1f0e2c9a77", "idx": {"timestamp": "1:2", "value": "bc"}, "redir": {"timestamp": "1:2", "value": 2}, "deleted": {"timestamp": "1:5", "value": 1}},
+            {"id": "inserted", "idx": {"timestamp": "1:3", "value": "bbn"}, "template": {"timestamp": "1:3", "value": "Blank"}, "modifed": "1690000000000"}
+        ],
+        "uuids": [{"first": "f3a5a5d9-4a27-4d8e-a8c5-2b4b1ea7d0c2", "second": 1}]
+    },
+    "fileType": "pdf",
+    "formatVersion": 2,
+    "pageCount": 3,
+    "pageTags": [{"name": "todo", "pageId": "p1", "timestamp": 1690000000000}],
+    "tags": [{"name": "work", "timestamp": 1690000000000}]
+}`
+
+func TestDocumentPagesV2(t *testing.T) {
+	content := Content{}
+	assert.Nil(t, json.Unmarshal([]byte(contentV2), &content))
+	assert.Equal(t, ContentFormatV2, content.FormatVersion)
+	assert.Equal(t, "work", content.Tags[0].Name)
+	assert.Equal(t, "p1", content.PageTags[0].PageId)
+
+	ids, redirection, templates := content.DocumentPages()
+	assert.Equal(t, []string{"p1", "p2", "inserted"}, ids)
+	assert.Equal(t, []int{0, 1, -1}, redirection)
+	assert.Equal(t, []string{"", "P Grid medium", "Blank"}, templates)
+}
+
+func TestDocumentPagesLegacy(t *testing.T) {
+	content := Content{Pages: []string{"a", "b", "c"}}
+	ids, redirection, _ := content.DocumentPages()
+	assert.Equal(t, []string{"a", "b", "c"}, ids)
+	assert.Equal(t, []int{0, 1, 2}, redirection)
+
+	content.RedirectionMap = []int{0, -1}
+	_, redirection, _ = content.DocumentPages()
+	assert.Equal(t, []int{0, -1, -1}, redirection)
+}
+
+func TestSetPagesV2(t *testing.T) {
+	content := Content{}
+	assert.Nil(t, json.Unmarshal([]byte(contentV2), &content))
+
+	content.SetPages([]string{"p2", "new", "p1"}, []int{0, 1, -1}, []string{"", "P Lines medium", ""})
+
+	ids, redirection, templates := content.DocumentPages()
+	assert.Equal(t, []string{"p2", "new", "p1"}, ids)
+	assert.Equal(t, []int{0, 1, -1}, redirection)
+	assert.Equal(t, []string{"P Grid medium", "P Lines medium", "Blank"}, templates)
+	assert.Equal(t, 3, content.PageCount)
+
+	// rmapi is registered as a new author and its changes are the newest
+	assert.Equal(t, CPageUUID{authorId, 2}, content.CPages.Uuids[1])
+	for _, p := range content.CPages.Pages {
+		switch p.Id {
+		case "inserted":
+			assert.True(t, p.IsDeleted())
+			assert.Equal(t, "2:6", p.Deleted.Timestamp)
+		case "0b7ac2f4-3c1e-4b8e-9a52-6d1f0e2c9a77":
+			assert.Equal(t, "1:5", p.Deleted.Timestamp)
+		default:
+			assert.Equal(t, "2:6", p.Idx.Timestamp)
+		}
+	}
+}
+
+func TestPageIndex(t *testing.T) {
+	assert.Equal(t, "ba", pageIndex(0, 3))
+	assert.Equal(t, "bc", pageIndex(2, 3))
+	assert.Equal(t, "bab", pageIndex(1, 30))
+	assert.True(t, pageIndex(25, 30) < pageIndex(26, 30))
+}
+
+func TestReadV2(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	files := map[string]string{
+		"id.content":                contentV2,
+		"id.pdf":                    "pdf",
+		"id/p2-metadata.json":       `{"layers":[{"name":"Layer 1"}]}`,
+		"id/inserted-metadata.json": `{"layers":[{"name":"Layer 1"}]}`,
+		"id/0b7ac2f4-3c1e-4b8e-9a52-6d1f0e2c9a77-metadata.json": `{"layers":[{"name":"Layer 1"}]}`,
+	}
+	for name, content := range files {
+		fw, _ := w.Create(name)
+		fw.Write([]byte(content))
+	}
+	w.Close()
+
+	z := NewZip()
+	if err := z.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 3, len(z.Pages))
+	assert.Equal(t, 1, z.Pages[1].DocPage)
+	assert.Equal(t, "P Grid medium", z.Pages[1].Pagedata)
+	assert.Equal(t, "Layer 1", z.Pages[1].Metadata.Layers[0].Name)
+	assert.Equal(t, -1, z.Pages[2].DocPage)
+	assert.Equal(t, "Layer 1", z.Pages[2].Metadata.Layers[0].Name)
+	assert.Equal(t, "inserted", z.pageName(2))
+}
+
+func TestUpdatePayloadV2(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "doc.zip")
+
+	f, _ := os.Create(src)
+	w := zip.NewWriter(f)
+	for name, content := range map[string]string{"id.content": contentV2, "id.pdf": "old", "id/p2.rm": "strokes"} {
+		fw, _ := w.Create(name)
+		fw.Write([]byte(content))
+	}
+	w.Close()
+	f.Close()
+
+	payload := filepath.Join(dir, "new.pdf")
+	os.WriteFile(payload, []byte("new"), 0600)
+
+	// p1 has been removed from the new version
+	dst := filepath.Join(dir, "updated.zip")
+	if err := UpdatePayload(src, payload, []int{1, 2}, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	read := readTestArchive(t, dst)
+	assert.NotContains(t, read, "id.pagedata")
+
+	content := Content{}
+	assert.Nil(t, json.Unmarshal([]byte(read["id.content"]), &content))
+	ids, redirection, templates := content.DocumentPages()
+	assert.Equal(t, "p2", ids[0])
+	assert.Equal(t, "inserted", ids[1])
+	assert.Equal(t, []int{0, -1, 1}, redirection)
+	assert.Equal(t, []string{"P Grid medium", "Blank", "Blank"}, templates)
+	assert.Equal(t, 2, content.CPages.Original.Value)
+	assert.Equal(t, "work", content.Tags[0].Name)
+	assert.Nil(t, content.Pages)
+}
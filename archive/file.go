@@ -1,7 +1,11 @@
 package archive
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/juruen/rmapi/encoding/rm"
+	"github.com/juruen/rmapi/model"
 )
 
 // Set the default pagedata template to Blank
@@ -103,11 +107,17 @@ type Content struct {
 	PageCount   int    `json:"pageCount"`
 	// Pages is a list of page IDs
 	Pages          []string `json:"pages"`
-	Tags           []string `json:"pageTags"`
 	RedirectionMap []int    `json:"redirectionPageMap"`
 	TextScale      int      `json:"textScale"`
 
 	Transform Transform `json:"transform"`
+
+	// FormatVersion is 2 when the pages are listed in CPages instead of Pages
+	FormatVersion     int       `json:"formatVersion,omitempty"`
+	CPages            *CPages   `json:"cPages,omitempty"`
+	OriginalPageCount int       `json:"originalPageCount,omitempty"`
+	Tags              []Tag     `json:"tags,omitempty"`
+	PageTags          []PageTag `json:"pageTags"`
 }
 
 // ExtraMetadata is a struct contained into a Content struct.
@@ -157,3 +167,28 @@ type MetadataFile struct {
 	Deleted          bool   `json:"deleted"`
 	MetadataModified bool   `json:"metadatamodified"`
 }
+
+// ToDocument converts the metadata of the document id to a model.Document
+func (m *MetadataFile) ToDocument(id string) *model.Document {
+	var lastModified string
+	unixTime, err := strconv.ParseInt(m.LastModified, 10, 64)
+	if err == nil {
+		//HACK: convert wrong nano timestamps to millis
+		if len(m.LastModified) > 18 {
+			unixTime /= 1000000
+		}
+
+		t := time.Unix(unixTime/1000, 0)
+		lastModified = t.UTC().Format(time.RFC3339Nano)
+	}
+	return &model.Document{
+		ID:             id,
+		VissibleName:   m.DocName,
+		Version:        m.Version,
+		Parent:         m.Parent,
+		Type:           m.CollectionType,
+		CurrentPage:    m.LastOpenedPage,
+		ModifiedClient: lastModified,
+		Bookmarked:     m.Pinned,
+	}
+}
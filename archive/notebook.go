@@ -0,0 +1,106 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/juruen/rmapi/encoding/rm"
+)
+
+// NotebookType is the file type of the .content of native notebooks
+const NotebookType = "notebook"
+
+// defaultLayer is the name the tablet gives to the first layer of a page
+const defaultLayer = "Layer 1"
+
+// templates maps friendly names to the names of the templates installed on the tablet
+var templates = map[string]string{
+	"blank":     "Blank",
+	"lined":     "P Lines medium",
+	"lines":     "P Lines medium",
+	"grid":      "P Grid medium",
+	"dots":      "P Dots S",
+	"checklist": "P Checklist",
+	"margin":    "P Margin medium",
+}
+
+// TemplateName returns the tablet template name for a friendly name such as
+// Blank, Lined, Grid, Dots or Checklist. Unknown names are returned unchanged
+// so that any template installed on the tablet can be used.
+func TemplateName(name string) string {
+	if name == "" {
+		return defaultPagadata
+	}
+	if t, ok := templates[strings.ToLower(name)]; ok {
+		return t
+	}
+
+	return name
+}
+
+// NewNotebook creates a native notebook with pageCount pages using the given
+// background template. When page is not nil every page starts with a copy of its strokes.
+func NewNotebook(pageCount int, template string, page *rm.Rm) *Zip {
+	z := NewZip()
+	z.UUID = uuid.New().String()
+	z.Content.FileType = NotebookType
+	z.Content.PageCount = pageCount
+	z.Content.Pages = make([]string, pageCount)
+	z.Pages = make([]Page, pageCount)
+
+	template = TemplateName(template)
+	for i := 0; i < pageCount; i++ {
+		data := rm.New()
+		if page != nil {
+			copied := *page
+			data = &copied
+		}
+
+		z.Content.Pages[i] = uuid.New().String()
+		z.Pages[i] = Page{
+			Data:     data,
+			Metadata: Metadata{Layers: []Layer{{Name: defaultLayer}}},
+			Pagedata: template,
+			DocPage:  i,
+		}
+	}
+
+	return z
+}
+
+// CreatePagedata creates the .pagedata file with a template name per page
+func CreatePagedata(id string, templates []string, fpath string) (fileName, filePath string, err error) {
+	fileName = id + ".pagedata"
+	filePath = path.Join(fpath, fileName)
+
+	content := ""
+	for _, t := range templates {
+		content += TemplateName(t) + "\n"
+	}
+
+	err = os.WriteFile(filePath, []byte(content), 0600)
+	return
+}
+
+// CreatePageMetadata creates the layer metadata file of a notebook page
+func CreatePageMetadata(id, pageId string, fpath string) (fileName, filePath string, err error) {
+	fileName = fmt.Sprintf("%s/%s-metadata.json", id, pageId)
+	filePath = filepath.Join(fpath, id, pageId+"-metadata.json")
+
+	c, err := json.Marshal(Metadata{Layers: []Layer{{Name: defaultLayer}}})
+	if err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return
+	}
+
+	err = os.WriteFile(filePath, c, 0600)
+	return
+}
@@ -0,0 +1,56 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/juruen/rmapi/encoding/rm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewNotebook(t *testing.T) {
+	notebook := NewNotebook(3, "Lined", nil)
+
+	buf := &bytes.Buffer{}
+	if err := notebook.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, f := range zr.File {
+		names[f.Name] = true
+	}
+	for _, pageId := range notebook.Content.Pages {
+		assert.True(t, names[notebook.UUID+"/"+pageId+".rm"], "missing page data")
+		assert.True(t, names[notebook.UUID+"/"+pageId+"-metadata.json"], "missing page metadata")
+	}
+
+	read := NewZip()
+	if err := read.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, notebook.UUID, read.UUID)
+	assert.Equal(t, NotebookType, read.Content.FileType)
+	assert.Equal(t, 3, read.Content.PageCount)
+	assert.Equal(t, 3, len(read.Pages))
+	for i, p := range read.Pages {
+		assert.Equal(t, "P Lines medium", p.Pagedata)
+		assert.Equal(t, i, p.DocPage)
+		assert.Equal(t, "Layer 1", p.Metadata.Layers[0].Name)
+		if assert.NotNil(t, p.Data) {
+			assert.Equal(t, rm.V5, p.Data.Version)
+		}
+	}
+}
+
+func TestTemplateName(t *testing.T) {
+	assert.Equal(t, "Blank", TemplateName(""))
+	assert.Equal(t, "P Grid medium", TemplateName("grid"))
+	assert.Equal(t, "LS Dots top", TemplateName("LS Dots top"))
+}
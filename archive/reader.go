@@ -35,7 +35,7 @@ func (z *Zip) Read(r io.ReaderAt, size int64) error {
 	}
 
 	//uploading and then downloading a file results in 0 pages
-	if z.Content.PageCount <= 0 {
+	if len(z.Pages) == 0 {
 		log.Warning.Printf("PageCount is 0")
 		return nil
 	}
@@ -89,27 +89,16 @@ func (z *Zip) readContent(zr *zip.Reader) error {
 	id, _ := util.DocPathToName(p)
 	z.UUID = id
 
-	redirectedCount := len(z.Content.RedirectionMap)
-	pagesCount := len(z.Content.Pages)
-	if redirectedCount > 0 {
+	ids, redirection, templates := z.Content.DocumentPages()
+	if len(ids) > 0 {
 		z.pageMap = make(map[string]int)
-		z.Pages = make([]Page, redirectedCount)
-		for index, docPage := range z.Content.RedirectionMap {
-			if index > pagesCount {
-				log.Warning.Print("redirection > pages")
-				break
-			}
-			pageUUID := z.Content.Pages[index]
-			z.pageMap[pageUUID] = index
-			z.Pages[index].DocPage = docPage
-		}
-
-	} else if pagesCount > 0 {
-		z.pageMap = make(map[string]int)
-		z.Pages = make([]Page, pagesCount)
-		for index, pageUUID := range z.Content.Pages {
+		z.Pages = make([]Page, len(ids))
+		for index, pageUUID := range ids {
 			z.pageMap[pageUUID] = index
-			z.Pages[index].DocPage = index
+			z.Pages[index].DocPage = redirection[index]
+			if index < len(templates) {
+				z.Pages[index].Pagedata = templates[index]
+			}
 		}
 	} else {
 		// instantiate the slice of pages
@@ -126,6 +115,11 @@ func (z *Zip) readPagedata(zr *zip.Reader) error {
 		return err
 	}
 
+	// v2 documents keep the templates in the .content
+	if len(files) == 0 && z.Content.CPages != nil {
+		return nil
+	}
+
 	if len(files) != 1 {
 		return errors.New("archive does not contain a unique pagedata file")
 	}
@@ -139,9 +133,12 @@ func (z *Zip) readPagedata(zr *zip.Reader) error {
 	// iterate pagedata file lines
 	sc := bufio.NewScanner(file)
 	var i int = 0
-	for sc.Scan() {
+	for sc.Scan() && i < len(z.Pages) {
 		line := sc.Text()
-		z.Pages[i].Pagedata = line
+		// the templates of a v2 .content take precedence
+		if z.Pages[i].Pagedata == "" {
+			z.Pages[i].Pagedata = line
+		}
 		i++
 	}
 
@@ -193,6 +190,10 @@ func (z *Zip) readData(zr *zip.Reader) error {
 		if err != nil {
 			return err
 		}
+		// files of deleted pages
+		if idx < 0 {
+			continue
+		}
 
 		if len(z.Pages) <= idx {
 			return errors.New("page not found")
@@ -228,10 +229,13 @@ func (z *Zip) readThumbnails(zr *zip.Reader) error {
 	for _, file := range files {
 		name, _ := splitExt(file.FileInfo().Name())
 
-		idx, err := strconv.Atoi(name)
+		idx, err := z.pageIndex(name)
 		if err != nil {
 			return errors.New("error in .jpg filename")
 		}
+		if idx < 0 {
+			continue
+		}
 
 		if len(z.Pages) <= idx {
 			return errors.New("page not found")
@@ -252,6 +256,10 @@ func (z *Zip) readThumbnails(zr *zip.Reader) error {
 }
 
 func (z *Zip) pageIndex(namePart string) (idx int, err error) {
+	if idx, ok := z.pageMap[namePart]; ok {
+		return idx, nil
+	}
+
 	idx, err = strconv.Atoi(namePart)
 	if err == nil {
 		return idx, nil
@@ -264,13 +272,10 @@ func (z *Zip) pageIndex(namePart string) (idx int, err error) {
 	if z.pageMap == nil {
 		return -1, errors.New("no uuid pagemap")
 	}
-	var ok bool
-	idx, ok = z.pageMap[namePart]
-	if !ok {
-		log.Warning.Println("Page not found in map: ", namePart)
-	}
 
-	return
+	// the page may have been deleted
+	log.Warning.Println("Page not found in map: ", namePart)
+	return -1, nil
 }
 
 // readMetadata extracts existing .json metadata files from an archive.
@@ -289,6 +294,9 @@ func (z *Zip) readMetadata(zr *zip.Reader) error {
 		if err != nil {
 			return err
 		}
+		if idx < 0 {
+			continue
+		}
 
 		if len(z.Pages) <= idx {
 			return errors.New("page not found")
@@ -0,0 +1,304 @@
+package archive
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/juruen/rmapi/util"
+)
+
+// RemapPages computes the pages and the redirection map of a document whose payload
+// is being replaced.
+//   - pages and redirection are the current values found in the .content
+//   - matches has one entry per page of the new payload with the index of the
+//     matching page in the old payload, or -1 if there is none
+//   - annotated tells which pages have handwriting
+//
+// Matched pages keep their ids, so their annotations follow them to the new payload.
+// Annotated pages that can't be matched and pages inserted on the tablet are kept
+// as inserted pages after the page they followed, so no handwriting is lost.
+func RemapPages(pages []string, redirection []int, matches []int, annotated map[string]bool) ([]string, []int) {
+	oldToNew := make(map[int]int)
+	for newPage, oldPage := range matches {
+		if _, ok := oldToNew[oldPage]; oldPage >= 0 && !ok {
+			oldToNew[oldPage] = newPage
+		}
+	}
+
+	ids := make([]string, len(matches))
+	// pages kept without a payload page, by the new page they follow (-1 for the beginning)
+	following := make(map[int][]string)
+	anchor := -1
+
+	for i, id := range pages {
+		docPage := i
+		if len(redirection) > 0 {
+			docPage = -1
+			if i < len(redirection) {
+				docPage = redirection[i]
+			}
+		}
+
+		if docPage >= 0 {
+			if newPage, ok := oldToNew[docPage]; ok && ids[newPage] == "" {
+				ids[newPage] = id
+				anchor = newPage
+				continue
+			}
+		}
+
+		if docPage < 0 || annotated[id] {
+			following[anchor] = append(following[anchor], id)
+		}
+	}
+
+	newPages := make([]string, 0, len(matches))
+	newRedirection := make([]int, 0, len(matches))
+	for _, id := range following[-1] {
+		newPages = append(newPages, id)
+		newRedirection = append(newRedirection, -1)
+	}
+
+	for newPage, id := range ids {
+		if id == "" {
+			id = uuid.New().String()
+		}
+		newPages = append(newPages, id)
+		newRedirection = append(newRedirection, newPage)
+
+		for _, id := range following[newPage] {
+			newPages = append(newPages, id)
+			newRedirection = append(newRedirection, -1)
+		}
+	}
+
+	return newPages, newRedirection
+}
+
+// UpdatePayload writes to dstPath a copy of the archive srcPath where the payload
+// is replaced by payloadPath, which has to be of the same type. Pages of a pdf are
+// remapped with RemapPages using matches, when matches is nil the pages are kept as they are.
+// Annotations, page templates and the rest of the .content are kept, and thumbnails
+// are dropped as they no longer match the document.
+func UpdatePayload(srcPath, payloadPath string, matches []int, dstPath string) error {
+	r, err := zip.OpenReader(srcPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	files, err := zipExtFinder(&r.Reader, ".content")
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return errors.New("archive does not contain a unique content file")
+	}
+	id := strings.TrimSuffix(files[0].Name, ".content")
+
+	raw, err := readAll(files[0])
+	if err != nil {
+		return err
+	}
+
+	// the .content is also kept as raw json to preserve the fields that rmapi doesn't know
+	content := make(map[string]json.RawMessage)
+	if err = json.Unmarshal(raw, &content); err != nil {
+		return err
+	}
+	parsed := Content{}
+	if err = json.Unmarshal(raw, &parsed); err != nil {
+		return err
+	}
+	fileType := parsed.FileType
+
+	_, ext := util.DocPathToName(payloadPath)
+	if fileType == "" || fileType == NotebookType {
+		return errors.New("the document has no payload to replace")
+	}
+	if ext != fileType {
+		return fmt.Errorf("a %s document can't be replaced by a %s file", fileType, ext)
+	}
+	if matches != nil && fileType != util.PDF {
+		return errors.New("pages can only be matched in pdf documents")
+	}
+
+	annotated := make(map[string]bool)
+	var pagedata []string
+	for _, f := range r.File {
+		dir, name := path.Split(f.Name)
+		if dir == id+"/" && path.Ext(name) == ".rm" {
+			annotated[strings.TrimSuffix(name, ".rm")] = true
+		}
+		if f.Name == id+".pagedata" {
+			if pagedata, err = readLines(f); err != nil {
+				return err
+			}
+		}
+	}
+
+	replaced := map[string][]byte{}
+
+	if matches != nil {
+		pages, redirection, templates := parsed.DocumentPages()
+		newPages, newRedirection := RemapPages(pages, redirection, matches, annotated)
+
+		pageTemplates := make(map[string]string)
+		for i, p := range pages {
+			if i < len(templates) && templates[i] != "" {
+				pageTemplates[p] = templates[i]
+			} else if i < len(pagedata) {
+				pageTemplates[p] = pagedata[i]
+			}
+		}
+		newTemplates := make([]string, len(newPages))
+		newPagedata := ""
+		for i, p := range newPages {
+			t, ok := pageTemplates[p]
+			if !ok {
+				t = defaultPagadata
+			}
+			newTemplates[i] = t
+			newPagedata += t + "\n"
+		}
+		if len(pagedata) > 0 || parsed.CPages == nil {
+			replaced[id+".pagedata"] = []byte(newPagedata)
+		}
+
+		parsed.SetPages(newPages, newRedirection, newTemplates)
+		if parsed.CPages != nil {
+			parsed.CPages.Original = CrdtInt{parsed.CPages.nextTimestamp(), len(matches)}
+		}
+		if parsed.OriginalPageCount != 0 {
+			parsed.OriginalPageCount = len(matches)
+		}
+
+		updated, err := json.Marshal(parsed)
+		if err != nil {
+			return err
+		}
+		updatedFields := make(map[string]json.RawMessage)
+		if err = json.Unmarshal(updated, &updatedFields); err != nil {
+			return err
+		}
+		for _, key := range []string{"pages", "redirectionPageMap", "pageCount", "cPages", "originalPageCount"} {
+			if _, ok := content[key]; ok || key == "pageCount" || parsed.CPages == nil {
+				if value, ok := updatedFields[key]; ok {
+					content[key] = value
+				}
+			}
+		}
+	}
+
+	if replaced[id+".content"], err = json.Marshal(content); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w := zip.NewWriter(out)
+	for _, f := range r.File {
+		if _, ok := replaced[f.Name]; ok || f.Name == id+"."+fileType || strings.HasPrefix(f.Name, id+".thumbnails/") {
+			continue
+		}
+
+		if err = w.Copy(f); err != nil {
+			return err
+		}
+	}
+
+	for name, data := range replaced {
+		fw, err := w.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err = fw.Write(data); err != nil {
+			return err
+		}
+	}
+
+	payload, err := os.Open(payloadPath)
+	if err != nil {
+		return err
+	}
+	defer payload.Close()
+
+	fw, err := w.Create(id + "." + fileType)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fw, payload); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// ReadPayload extracts the payload of the archive srcPath into dstPath
+func ReadPayload(srcPath, dstPath string) error {
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	z := NewZip()
+	zr, err := zip.NewReader(file, fi.Size())
+	if err != nil {
+		return err
+	}
+	if err = z.readContent(zr); err != nil {
+		return err
+	}
+	if err = z.readPayload(zr); err != nil {
+		return err
+	}
+	if z.Payload == nil {
+		return errors.New("archive does not contain a payload")
+	}
+
+	return os.WriteFile(dstPath, z.Payload, 0600)
+}
+
+func readAll(f *zip.File) ([]byte, error) {
+	file, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+func readLines(f *zip.File) ([]string, error) {
+	file, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	sc := bufio.NewScanner(file)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+
+	return lines, sc.Err()
+}
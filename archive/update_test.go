@@ -0,0 +1,137 @@
+package archive
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemapPages(t *testing.T) {
+	pages := []string{"a", "b", "inserted", "c", "d"}
+	redirection := []int{0, 1, -1, 2, 3}
+	annotated := map[string]bool{"b": true, "inserted": true, "c": true}
+
+	// new payload: a new page at the beginning, page c removed
+	matches := []int{-1, 0, 1, 3}
+	newPages, newRedirection := RemapPages(pages, redirection, matches, annotated)
+
+	assert.Equal(t, 6, len(newPages))
+	assert.NotContains(t, []string{"a", "b", "c", "d", "inserted"}, newPages[0])
+	assert.Equal(t, []string{"a", "b", "inserted", "c", "d"}, newPages[1:])
+	assert.Equal(t, []int{0, 1, 2, -1, -1, 3}, newRedirection)
+}
+
+func TestRemapPagesWithoutRedirection(t *testing.T) {
+	newPages, newRedirection := RemapPages([]string{"a", "b"}, nil, []int{1, 0}, nil)
+
+	assert.Equal(t, []string{"b", "a"}, newPages)
+	assert.Equal(t, []int{0, 1}, newRedirection)
+}
+
+func writeTestArchive(t *testing.T, dir string) string {
+	src := filepath.Join(dir, "doc.zip")
+
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	files := map[string]string{
+		"id.content":           `{"fileType":"pdf","pages":["p1","p2"],"pageCount":2,"lastOpenedPage":1,"customField":true}`,
+		"id.pagedata":          "Blank\nP Grid medium\n",
+		"id.pdf":               "old",
+		"id/p2.rm":             "strokes",
+		"id.thumbnails/p2.jpg": "thumb",
+	}
+	for name, content := range files {
+		fw, _ := w.Create(name)
+		fw.Write([]byte(content))
+	}
+	w.Close()
+	f.Close()
+
+	return src
+}
+
+func readTestArchive(t *testing.T, path string) map[string]string {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	read := make(map[string]string)
+	for _, f := range r.File {
+		rc, _ := f.Open()
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		read[f.Name] = string(b)
+	}
+	return read
+}
+
+type testContent struct {
+	Pages          []string `json:"pages"`
+	RedirectionMap []int    `json:"redirectionPageMap"`
+	PageCount      int      `json:"pageCount"`
+	LastOpenedPage int      `json:"lastOpenedPage"`
+	CustomField    bool     `json:"customField"`
+}
+
+func TestUpdatePayload(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestArchive(t, dir)
+
+	payload := filepath.Join(dir, "new.pdf")
+	os.WriteFile(payload, []byte("new"), 0600)
+
+	dst := filepath.Join(dir, "updated.zip")
+	// p2 is now the first page followed by a new page, p1 is gone
+	if err := UpdatePayload(src, payload, []int{1, -1}, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	read := readTestArchive(t, dst)
+	assert.Equal(t, "new", read["id.pdf"])
+	assert.Equal(t, "strokes", read["id/p2.rm"])
+	assert.NotContains(t, read, "id.thumbnails/p2.jpg")
+
+	content := testContent{}
+	assert.Nil(t, json.Unmarshal([]byte(read["id.content"]), &content))
+	assert.Equal(t, "p2", content.Pages[0])
+	assert.Equal(t, []int{0, 1}, content.RedirectionMap)
+	assert.Equal(t, 2, content.PageCount)
+	assert.True(t, content.CustomField)
+	assert.Equal(t, "P Grid medium\nBlank\n", read["id.pagedata"])
+}
+
+func TestUpdatePayloadKeepsPages(t *testing.T) {
+	dir := t.TempDir()
+	src := writeTestArchive(t, dir)
+
+	payload := filepath.Join(dir, "new.pdf")
+	os.WriteFile(payload, []byte("new"), 0600)
+
+	dst := filepath.Join(dir, "updated.zip")
+	if err := UpdatePayload(src, payload, nil, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	read := readTestArchive(t, dst)
+	assert.Equal(t, "new", read["id.pdf"])
+	assert.Equal(t, "Blank\nP Grid medium\n", read["id.pagedata"])
+
+	content := testContent{}
+	assert.Nil(t, json.Unmarshal([]byte(read["id.content"]), &content))
+	assert.Equal(t, []string{"p1", "p2"}, content.Pages)
+	assert.Equal(t, 1, content.LastOpenedPage)
+
+	epub := filepath.Join(dir, "new.epub")
+	os.WriteFile(epub, []byte("new"), 0600)
+	assert.NotNil(t, UpdatePayload(src, epub, nil, dst))
+}
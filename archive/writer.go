@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -54,6 +55,13 @@ func (z *Zip) Write(w io.Writer) error {
 
 // writeContent writes the .content file to the archive.
 func (z *Zip) writeContent(zw *zip.Writer) error {
+	// v2 documents keep the templates in the .content too
+	templates := make([]string, len(z.Pages))
+	for i, page := range z.Pages {
+		templates[i] = page.Pagedata
+	}
+	z.Content.setTemplates(templates)
+
 	bytes, err := json.MarshalIndent(&z.Content, "", "    ")
 	if err != nil {
 		return err
@@ -135,8 +143,8 @@ func (z *Zip) writeThumbnails(zw *zip.Writer) error {
 			continue
 		}
 
-		folder := fmt.Sprintf("%s.thumbnail", z.UUID)
-		name := fmt.Sprintf("%d.jpg", idx)
+		folder := fmt.Sprintf("%s.thumbnails", z.UUID)
+		name := fmt.Sprintf("%s.jpg", z.pageName(idx))
 		fn := filepath.Join(folder, name)
 
 		w, err := addToZip(zw, fn)
@@ -162,7 +170,7 @@ func (z *Zip) writeMetadata(zw *zip.Writer) error {
 			continue
 		}
 
-		name := fmt.Sprintf("%d-metadata.json", idx)
+		name := fmt.Sprintf("%s-metadata.json", z.pageName(idx))
 		fn := filepath.Join(z.UUID, name)
 
 		w, err := addToZip(zw, fn)
@@ -192,7 +200,7 @@ func (z *Zip) writeData(zw *zip.Writer) error {
 			continue
 		}
 
-		name := fmt.Sprintf("%d.rm", idx)
+		name := fmt.Sprintf("%s.rm", z.pageName(idx))
 		fn := filepath.Join(z.UUID, name)
 
 		w, err := addToZip(zw, fn)
@@ -214,6 +222,17 @@ func (z *Zip) writeData(zw *zip.Writer) error {
 	return nil
 }
 
+// pageName returns the name used for the files of a page:
+// its UUID when the content lists the pages or its index otherwise.
+func (z *Zip) pageName(idx int) string {
+	ids, _, _ := z.Content.DocumentPages()
+	if idx < len(ids) && ids[idx] != "" {
+		return ids[idx]
+	}
+
+	return strconv.Itoa(idx)
+}
+
 // addToZip takes a zip.Writer in parameter and creates an io.Writer
 // to write the content of a file to add to the zip.
 func addToZip(zw *zip.Writer, name string) (io.Writer, error) {
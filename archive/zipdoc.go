@@ -100,8 +100,19 @@ func CreateZipDocument(id, srcPath string) (zipPath string, err error) {
 		pageUUID := uuid.New()
 		pageID := pageUUID.String()
 		documentPath = fmt.Sprintf("%s/%s.rm", id, pageID)
-		fileType = "notebook"
+		fileType = NotebookType
 		pages = append(pages, pageID)
+
+		f, err := w.Create(fmt.Sprintf("%s/%s-metadata.json", id, pageID))
+		if err != nil {
+			log.Error.Println("failed to create page metadata entry in zip file", err)
+			return "", err
+		}
+		layers, err := json.Marshal(Metadata{Layers: []Layer{{Name: defaultLayer}}})
+		if err != nil {
+			return "", err
+		}
+		f.Write(layers)
 	} else {
 		documentPath = fmt.Sprintf("%s.%s", id, ext)
 		pages = append(pages, "")
@@ -136,7 +147,9 @@ func CreateZipDocument(id, srcPath string) (zipPath string, err error) {
 		log.Error.Println("failed to create content entry in zip file", err)
 		return
 	}
-	f.Write(make([]byte, 0))
+	if ext == util.RM {
+		f.Write([]byte(defaultPagadata + "\n"))
+	}
 
 	// Create content content
 	f, err = w.Create(fmt.Sprintf("%s.content", id))
@@ -208,6 +221,10 @@ func createZipContent(ext string, pageIDs []string) (string, error) {
 		Pages: pageIDs,
 	}
 
+	if ext == NotebookType {
+		c.PageCount = len(pageIDs)
+	}
+
 	cstring, err := json.Marshal(c)
 
 	if err != nil {
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/juruen/rmapi/api"
+	"github.com/juruen/rmapi/config"
+)
+
+const codeEnvVar = "RMAPI_CODE"
+
+const authUsage = `usage: rmapi [-profile name] auth <command>
+
+  login [--code code]	registers this device with a one-time code from
+			https://my.remarkable.com/device/desktop/connect, read from
+			RMAPI_CODE or asked for when --code isn't given
+  status		prints the user, the sync version and the expiry of the token
+  refresh		renews the user token
+  logout		removes the tokens`
+
+// authCommand runs the auth offline commands that manage the tokens of a profile
+func authCommand(args []string, profile string, nonInteractive bool) error {
+	if len(args) == 0 {
+		return errors.New(authUsage)
+	}
+
+	// the endpoints come from the profile
+	if err := config.UseProfile(profile); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "login":
+		flagSet := flag.NewFlagSet("auth login", flag.ContinueOnError)
+		code := flagSet.String("code", os.Getenv(codeEnvVar), "one-time code")
+		if err := flagSet.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		info, err := api.Login(profile, strings.TrimSpace(*code), nonInteractive)
+		if err != nil {
+			return err
+		}
+		fmt.Println("logged in as", info.User)
+		return nil
+	case "status":
+		store, err := api.ProfileTokenStore(profile, nonInteractive)
+		if err != nil {
+			return err
+		}
+		tokens, err := store.Load()
+		if err != nil {
+			return err
+		}
+		if tokens.DeviceToken == "" {
+			fmt.Println("not logged in")
+			return nil
+		}
+		if tokens.UserToken == "" {
+			fmt.Println("logged in, no user token yet")
+			return nil
+		}
+
+		info, err := api.ParseTokenInfo(tokens.UserToken)
+		if err != nil {
+			return err
+		}
+		printTokenInfo(info)
+		return nil
+	case "refresh":
+		info, err := api.RefreshToken(profile, nonInteractive)
+		if err != nil {
+			return err
+		}
+		printTokenInfo(info)
+		return nil
+	case "logout":
+		if err := api.Logout(profile, nonInteractive); err != nil {
+			return err
+		}
+		fmt.Println("tokens removed, the device can be removed from the account on https://my.remarkable.com")
+		return nil
+	default:
+		return errors.New(authUsage)
+	}
+}
+
+func printTokenInfo(info *api.TokenInfo) {
+	fmt.Println("user:", info.User)
+	fmt.Println("sync version:", info.SyncVersion)
+	fmt.Println("scopes:", strings.Join(info.Scopes, " "))
+
+	switch {
+	case info.ExpiresAt.IsZero():
+		fmt.Println("expires: never")
+	case info.Expired():
+		fmt.Println("expires:", info.ExpiresAt.Format(time.RFC3339), "(expired)")
+	default:
+		fmt.Printf("expires: %s (in %s)\n", info.ExpiresAt.Format(time.RFC3339), time.Until(info.ExpiresAt).Round(time.Minute))
+	}
+}
@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	shlex "github.com/flynn-archive/go-shlex"
+	"github.com/juruen/rmapi/config"
+	"github.com/juruen/rmapi/model"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// DeviceTokenEnvVar and UserTokenEnvVar are read by EnvTokenStore
+	DeviceTokenEnvVar = "RMAPI_DEVICE_TOKEN"
+	UserTokenEnvVar   = "RMAPI_USER_TOKEN"
+
+	// PassphraseEnvVar holds the passphrase of the encrypted token file
+	PassphraseEnvVar = "RMAPI_PASSPHRASE"
+
+	helperHost = "my.remarkable.com"
+)
+
+// NewProfileTokenStore returns the store of the tokens of profile selected by opts.
+// passphrase is called to get the passphrase of an encrypted store.
+func NewProfileTokenStore(profile string, opts config.TokenStoreOptions, passphrase func() (string, error)) (TokenStore, error) {
+	switch opts.Type {
+	case "", "config":
+		return &ConfigTokenStore{Profile: profile}, nil
+	case "env":
+		return &EnvTokenStore{}, nil
+	case "helper":
+		if opts.Helper == "" {
+			return nil, errors.New("auth: the helper token store needs a helper command")
+		}
+		return &HelperTokenStore{Command: opts.Helper, Profile: profile}, nil
+	case "encrypted":
+		path := opts.Path
+		if path == "" {
+			configPath, err := config.ConfigPath()
+			if err != nil {
+				return nil, err
+			}
+			path = configPath + ".tokens"
+			if profile != "" {
+				path = configPath + "." + profile + ".tokens"
+			}
+		}
+		return &EncryptedFileTokenStore{Path: path, Passphrase: passphrase}, nil
+	default:
+		return nil, fmt.Errorf("auth: unknown token store %s", opts.Type)
+	}
+}
+
+// Reset removes the tokens of a store
+func Reset(ts TokenStore) error {
+	if es, ok := ts.(*EncryptedFileTokenStore); ok {
+		err := os.Remove(es.Path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return ts.Save(TokenSet{})
+}
+
+// ConfigTokenStore implements TokenStore by keeping the tokens in a profile
+// of the config file, in plain text.
+type ConfigTokenStore struct {
+	Profile string
+}
+
+// Save stores the tokens in the profile keeping the rest of the config file.
+func (cs *ConfigTokenStore) Save(t TokenSet) error {
+	return config.SaveProfileTokens(cs.Profile, model.AuthTokens{DeviceToken: t.DeviceToken, UserToken: t.UserToken})
+}
+
+// Load returns the tokens of the profile.
+func (cs *ConfigTokenStore) Load() (TokenSet, error) {
+	tokens, err := config.LoadProfileTokens(cs.Profile)
+	if err != nil {
+		return TokenSet{}, err
+	}
+
+	return TokenSet{DeviceToken: tokens.DeviceToken, UserToken: tokens.UserToken}, nil
+}
+
+// EnvTokenStore implements a read-only TokenStore with the tokens found in the
+// RMAPI_DEVICE_TOKEN and RMAPI_USER_TOKEN environment variables.
+// Saved tokens, e.g. a renewed user token, are only kept in memory.
+type EnvTokenStore struct {
+	saved *TokenSet
+}
+
+// Save keeps the tokens for the next Load, nothing is written.
+func (es *EnvTokenStore) Save(t TokenSet) error {
+	es.saved = &t
+	return nil
+}
+
+// Load returns the tokens of the environment, or the ones saved since.
+func (es *EnvTokenStore) Load() (TokenSet, error) {
+	if es.saved != nil {
+		return *es.saved, nil
+	}
+
+	return TokenSet{
+		DeviceToken: os.Getenv(DeviceTokenEnvVar),
+		UserToken:   os.Getenv(UserTokenEnvVar),
+	}, nil
+}
+
+// EncryptedFileTokenStore implements TokenStore by keeping the tokens in a file
+// encrypted with AES-GCM and a key derived from a passphrase with scrypt.
+type EncryptedFileTokenStore struct {
+	Path string
+
+	// Passphrase returns the passphrase of the file, it's called once.
+	Passphrase func() (string, error)
+
+	passphrase string
+}
+
+// encryptedFile is the content of the file of EncryptedFileTokenStore
+type encryptedFile struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// Save encrypts the tokens into the file.
+func (es *EncryptedFileTokenStore) Save(t TokenSet) error {
+	plain, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	f := encryptedFile{Salt: make([]byte, 16)}
+	if _, err = rand.Read(f.Salt); err != nil {
+		return err
+	}
+
+	aead, err := es.cipher(f.Salt)
+	if err != nil {
+		return err
+	}
+
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Data = aead.Seal(nil, f.Nonce, plain, nil)
+
+	content, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(es.Path, content, 0600)
+}
+
+// Load decrypts the tokens of the file, a missing file has no tokens.
+func (es *EncryptedFileTokenStore) Load() (TokenSet, error) {
+	content, err := ioutil.ReadFile(es.Path)
+	if os.IsNotExist(err) {
+		return TokenSet{}, nil
+	}
+	if err != nil {
+		return TokenSet{}, err
+	}
+
+	var f encryptedFile
+	if err = json.Unmarshal(content, &f); err != nil {
+		return TokenSet{}, fmt.Errorf("auth: %s is not a token file: %v", es.Path, err)
+	}
+
+	aead, err := es.cipher(f.Salt)
+	if err != nil {
+		return TokenSet{}, err
+	}
+
+	plain, err := aead.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return TokenSet{}, errors.New("auth: wrong passphrase or corrupt token file")
+	}
+
+	var tks TokenSet
+	if err = json.Unmarshal(plain, &tks); err != nil {
+		return TokenSet{}, err
+	}
+
+	return tks, nil
+}
+
+func (es *EncryptedFileTokenStore) cipher(salt []byte) (cipher.AEAD, error) {
+	if es.passphrase == "" {
+		if es.Passphrase == nil {
+			return nil, errors.New("auth: missing passphrase")
+		}
+		passphrase, err := es.Passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if passphrase == "" {
+			return nil, errors.New("auth: empty passphrase")
+		}
+		es.passphrase = passphrase
+	}
+
+	key, err := scrypt.Key([]byte(es.passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// HelperTokenStore implements TokenStore with an external credential helper speaking
+// the protocol of git credential helpers, e.g. "git credential-osxkeychain".
+// The helper is run with get, store or erase and each token is a credential
+// for my.remarkable.com with the profile as username and the token name as path.
+type HelperTokenStore struct {
+	Command string
+	Profile string
+}
+
+// Save stores the tokens with the helper, empty tokens are erased.
+func (hs *HelperTokenStore) Save(t TokenSet) error {
+	for name, token := range map[string]string{"devicetoken": t.DeviceToken, "usertoken": t.UserToken} {
+		attrs := hs.attributes(name)
+		op := "erase"
+		if token != "" {
+			op = "store"
+			attrs["password"] = token
+		}
+		if _, err := hs.run(op, attrs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Load returns the tokens known by the helper.
+func (hs *HelperTokenStore) Load() (TokenSet, error) {
+	var tks TokenSet
+	for name, token := range map[string]*string{"devicetoken": &tks.DeviceToken, "usertoken": &tks.UserToken} {
+		attrs, err := hs.run("get", hs.attributes(name))
+		if err != nil {
+			return TokenSet{}, err
+		}
+		*token = attrs["password"]
+	}
+
+	return tks, nil
+}
+
+func (hs *HelperTokenStore) attributes(name string) map[string]string {
+	username := hs.Profile
+	if username == "" {
+		username = "default"
+	}
+
+	return map[string]string{
+		"protocol": "https",
+		"host":     helperHost,
+		"username": username,
+		"path":     name,
+	}
+}
+
+// run calls the helper with the operation op and the attributes on its input,
+// and returns the attributes of its output
+func (hs *HelperTokenStore) run(op string, attrs map[string]string) (map[string]string, error) {
+	args, err := shlex.Split(hs.Command)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("auth: empty credential helper")
+	}
+
+	var input bytes.Buffer
+	for _, k := range []string{"protocol", "host", "path", "username", "password"} {
+		if v, ok := attrs[k]; ok {
+			fmt.Fprintf(&input, "%s=%s\n", k, v)
+		}
+	}
+	input.WriteString("\n")
+
+	cmd := exec.Command(args[0], append(args[1:], op)...)
+	cmd.Stdin = &input
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("auth: credential helper %s failed: %v", op, err)
+	}
+
+	result := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(output))
+	for sc.Scan() {
+		if k, v, ok := strings.Cut(sc.Text(), "="); ok {
+			result[k] = v
+		}
+	}
+
+	return result, sc.Err()
+}
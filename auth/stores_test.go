@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptedFileTokenStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	passphrase := func() (string, error) { return "secret", nil }
+
+	store := &EncryptedFileTokenStore{Path: path, Passphrase: passphrase}
+	tks, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, TokenSet{}, tks)
+
+	err = store.Save(TokenSet{DeviceToken: "device", UserToken: "user"})
+	assert.NoError(t, err)
+
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "device")
+
+	tks, err = (&EncryptedFileTokenStore{Path: path, Passphrase: passphrase}).Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "device", tks.DeviceToken)
+	assert.Equal(t, "user", tks.UserToken)
+
+	wrong := func() (string, error) { return "wrong", nil }
+	_, err = (&EncryptedFileTokenStore{Path: path, Passphrase: wrong}).Load()
+	assert.Error(t, err)
+
+	assert.NoError(t, Reset(store))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestEnvTokenStore(t *testing.T) {
+	t.Setenv(DeviceTokenEnvVar, "device")
+	t.Setenv(UserTokenEnvVar, "")
+
+	store := &EnvTokenStore{}
+	tks, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "device", tks.DeviceToken)
+
+	// a renewed token is kept in memory
+	assert.NoError(t, store.Save(TokenSet{DeviceToken: "device", UserToken: "user"}))
+	tks, _ = store.Load()
+	assert.Equal(t, "user", tks.UserToken)
+	assert.Equal(t, "", os.Getenv(UserTokenEnvVar))
+}
+
+func TestHelperTokenStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the helper is a shell script")
+	}
+
+	// the helper keeps one file per credential, named after the username and path
+	dir := t.TempDir()
+	helper := filepath.Join(dir, "helper")
+	script := `#!/bin/sh
+while IFS== read -r k v; do
+	[ -z "$k" ] && break
+	eval "$k=\"\$v\""
+done
+f="` + dir + `/$username-$path"
+case "$1" in
+get) [ -f "$f" ] && echo "password=$(cat "$f")" ;;
+store) printf %s "$password" > "$f" ;;
+erase) rm -f "$f" ;;
+esac
+exit 0
+`
+	if err := ioutil.WriteFile(helper, []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &HelperTokenStore{Command: helper, Profile: "teaching"}
+	assert.NoError(t, store.Save(TokenSet{DeviceToken: "device", UserToken: "user"}))
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "teaching-devicetoken"))
+	assert.NoError(t, err)
+	assert.Equal(t, "device", string(content))
+
+	tks, err := store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, TokenSet{DeviceToken: "device", UserToken: "user"}, tks)
+
+	assert.NoError(t, store.Save(TokenSet{DeviceToken: "device"}))
+	tks, err = store.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, "", tks.UserToken)
+}
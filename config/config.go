@@ -81,16 +81,17 @@ func LoadTokens(path string) model.AuthTokens {
 	return tokens
 }
 
+// SaveTokens stores the tokens of the default profile keeping the rest of the config file
 func SaveTokens(path string, tokens model.AuthTokens) {
-	content, err := yaml.Marshal(tokens)
-
+	cfg, err := LoadConfig(path)
 	if err != nil {
-		log.Warning.Println("failed to marsha tokens", err)
+		log.Warning.Println("failed to read config, overwriting it", err)
+		cfg = &Config{}
 	}
 
-	ioutil.WriteFile(path, content, 0600)
+	cfg.AuthTokens = tokens
 
-	if err != nil {
+	if err = cfg.Save(path); err != nil {
 		log.Warning.Println("failed to save config to", path)
 	}
 }
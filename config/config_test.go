@@ -115,3 +115,71 @@ func TestConfigPath(t *testing.T) {
 		wg.Wait()
 	}
 }
+
+func TestProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rmapi.conf")
+	t.Setenv(configFileEnvVar, path)
+	t.Setenv("RMAPI_HOST", "")
+	t.Setenv("RMAPI_CONCURRENT", "")
+
+	content := `devicetoken: foo
+usertoken: bar
+concurrent: 5
+profiles:
+  teaching:
+    devicetoken: teachingdevice
+    backend: local
+    dir: /backups/teaching
+    host: https://example.com
+    export:
+      pagenumbers: true
+`
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// older versions only read the tokens
+	assert.Equal(t, "foo", LoadTokens(path).DeviceToken)
+
+	settings, err := Settings("")
+	assert.NoError(t, err)
+	assert.Equal(t, "cloud", settings.Backend)
+	assert.Equal(t, 5, settings.Concurrent)
+
+	settings, err = Settings("teaching")
+	assert.NoError(t, err)
+	assert.Equal(t, "teachingdevice", settings.DeviceToken)
+	assert.Equal(t, "local", settings.Backend)
+	assert.Equal(t, "/backups/teaching", settings.Dir)
+	assert.Equal(t, 20, settings.Concurrent)
+	assert.True(t, settings.Export.PageNumbers)
+
+	// each profile talks to its own hosts
+	urls, err := ProfileUrls("teaching")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/sync/v2/signed-urls/uploads", urls.UploadBlob)
+	urls, err = ProfileUrls("")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://internal.cloud.remarkable.com/sync/v2/signed-urls/uploads", urls.UploadBlob)
+
+	t.Setenv("RMAPI_HOST", "http://localhost:8080")
+	settings, err = Settings("teaching")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080", settings.Host)
+
+	// saving tokens keeps the rest of the file
+	err = SaveProfileTokens("alice", model.AuthTokens{DeviceToken: "alicedevice"})
+	assert.NoError(t, err)
+	SaveTokens(path, model.AuthTokens{DeviceToken: "new"})
+
+	cfg, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", cfg.DeviceToken)
+	assert.Equal(t, 5, cfg.Concurrent)
+	assert.Equal(t, "/backups/teaching", cfg.Profiles["teaching"].Dir)
+	assert.Equal(t, "alicedevice", cfg.Profiles["alice"].DeviceToken)
+
+	tokens, err := LoadProfileTokens("missing")
+	assert.NoError(t, err)
+	assert.Equal(t, "", tokens.DeviceToken)
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/juruen/rmapi/log"
+	"github.com/juruen/rmapi/model"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	profileEnvVar     = "RMAPI_PROFILE"
+	defaultConcurrent = 20
+)
+
+// ExportOptions are the default options of geta
+type ExportOptions struct {
+	PageNumbers     bool `yaml:"pagenumbers,omitempty"`
+	AllPages        bool `yaml:"allpages,omitempty"`
+	AnnotationsOnly bool `yaml:"annotationsonly,omitempty"`
+}
+
+// TokenStoreOptions tell where the tokens of a profile are kept
+type TokenStoreOptions struct {
+	// Type is config (the default) to keep them in the config file, encrypted, helper or env
+	Type string `yaml:"type,omitempty"`
+	// Path is the file of the encrypted store
+	Path string `yaml:"path,omitempty"`
+	// Helper is the command line of the credential helper
+	Helper string `yaml:"helper,omitempty"`
+}
+
+// Profile holds the tokens and the settings of an account
+type Profile struct {
+	model.AuthTokens `yaml:",inline"`
+	TokenStore       TokenStoreOptions `yaml:"tokenstore,omitempty"`
+
+	// Backend is where the documents are: cloud, local or usb
+	Backend string `yaml:"backend,omitempty"`
+	// Dir is the directory of the local backend
+	Dir string `yaml:"dir,omitempty"`
+	// UsbHost is the address of the tablet for the usb backend
+	UsbHost string `yaml:"usbhost,omitempty"`
+
+	// Host overrides the hosts of all the cloud endpoints
+	Host     string `yaml:"host,omitempty"`
+	AuthHost string `yaml:"authhost,omitempty"`
+	DocHost  string `yaml:"dochost,omitempty"`
+	SyncHost string `yaml:"synchost,omitempty"`
+
+	// Concurrent is the maximum number of concurrent requests of the sync 1.5 API
+	Concurrent int `yaml:"concurrent,omitempty"`
+	// CacheDir is where the document tree is cached
+	CacheDir    string        `yaml:"cachedir,omitempty"`
+	HiddenFiles bool          `yaml:"hiddenfiles,omitempty"`
+	Export      ExportOptions `yaml:"export,omitempty"`
+}
+
+// Config is the content of the config file. The settings at the top level are the
+// default profile, so a file with only tokens, as written by older versions, still works.
+type Config struct {
+	Profile  `yaml:",inline"`
+	Profiles map[string]*Profile `yaml:"profiles,omitempty"`
+}
+
+var (
+	activeMu   sync.Mutex
+	activeName string
+	active     *Profile
+)
+
+// LoadConfig reads the config file at path, a missing file is an empty config
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = yaml.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Save writes the config file at path
+func (c *Config) Save(path string) error {
+	content, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, content, 0600)
+}
+
+// Get returns the profile called name, the empty name is the default profile.
+// A profile that doesn't exist is created.
+func (c *Config) Get(name string) *Profile {
+	if name == "" {
+		return &c.Profile
+	}
+
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]*Profile)
+	}
+	if _, ok := c.Profiles[name]; !ok {
+		c.Profiles[name] = &Profile{}
+	}
+	return c.Profiles[name]
+}
+
+// Settings returns the settings of the profile called name as found in the config file,
+// overridden by the environment variables and with defaults for what is not set
+func Settings(name string) (Profile, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return Profile{}, err
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if name != "" {
+		if _, ok := cfg.Profiles[name]; !ok {
+			log.Trace.Printf("profile %s not found, using an empty one", name)
+		}
+	}
+	p := *cfg.Get(name)
+	p.applyEnv()
+
+	if p.Backend == "" {
+		p.Backend = "cloud"
+	}
+	if p.Concurrent <= 0 {
+		p.Concurrent = defaultConcurrent
+	}
+
+	return p, nil
+}
+
+func (p *Profile) applyEnv() {
+	if host := os.Getenv("RMAPI_DOC"); host != "" {
+		p.DocHost = host
+	}
+	if host := os.Getenv("RMAPI_AUTH"); host != "" {
+		p.AuthHost = host
+	}
+	if host := os.Getenv("RMAPI_HOST"); host != "" {
+		p.Host = host
+	}
+	if c, err := strconv.Atoi(os.Getenv("RMAPI_CONCURRENT")); err == nil {
+		p.Concurrent = c
+	}
+	if val, ok := os.LookupEnv("RMAPI_USE_HIDDEN_FILES"); ok {
+		p.HiddenFiles = val != "0"
+	}
+	if store := os.Getenv("RMAPI_TOKEN_STORE"); store != "" {
+		p.TokenStore.Type = store
+	}
+}
+
+// UseProfile makes name the profile used by Active.
+// Until it's called the profile given by RMAPI_PROFILE is used.
+func UseProfile(name string) error {
+	p, err := Settings(name)
+	if err != nil {
+		return err
+	}
+
+	activeMu.Lock()
+	activeName = name
+	active = &p
+	activeMu.Unlock()
+
+	return nil
+}
+
+// Active returns the settings of the profile in use
+func Active() Profile {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+
+	if active == nil {
+		activeName = os.Getenv(profileEnvVar)
+		p, err := Settings(activeName)
+		if err != nil {
+			log.Warning.Println("failed to read the config file, using the defaults:", err)
+			p = Profile{Backend: "cloud", Concurrent: defaultConcurrent}
+			p.applyEnv()
+		}
+		active = &p
+	}
+
+	return *active
+}
+
+// ActiveName returns the name of the profile in use
+func ActiveName() string {
+	Active()
+
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	return activeName
+}
+
+// LoadProfileTokens returns the tokens of the profile called name
+func LoadProfileTokens(name string) (model.AuthTokens, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return model.AuthTokens{}, err
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return model.AuthTokens{}, err
+	}
+
+	if _, ok := cfg.Profiles[name]; name != "" && !ok {
+		return model.AuthTokens{}, nil
+	}
+	return cfg.Get(name).AuthTokens, nil
+}
+
+// SaveProfileTokens stores the tokens of the profile called name keeping the rest of the config file
+func SaveProfileTokens(name string, tokens model.AuthTokens) error {
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	cfg.Get(name).AuthTokens = tokens
+	return cfg.Save(path)
+}
@@ -1,49 +1,60 @@
 package config
 
-import "os"
-
-var NewTokenDevice string
-var NewUserDevice string
-var DocHost string
-var ListDocs string
-var UpdateStatus string
-var UploadRequest string
-var DeleteEntry string
-var UploadBlob string
-var DownloadBlob string
-var SyncComplete string
+// Urls are the endpoints of the cloud an account talks to
+type Urls struct {
+	NewTokenDevice string
+	NewUserDevice  string
+	ListDocs       string
+	UpdateStatus   string
+	UploadRequest  string
+	DeleteEntry    string
+	UploadBlob     string
+	DownloadBlob   string
+	SyncComplete   string
+}
 
-func init() {
+// Urls resolves the urls of the endpoints from the hosts of the profile
+func (p Profile) Urls() Urls {
 	docHost := "https://document-storage-production-dot-remarkable-production.appspot.com"
 	authHost := "https://webapp-prod.cloud.remarkable.engineering"
 	syncHost := "https://internal.cloud.remarkable.com"
 
-	host := os.Getenv("RMAPI_DOC")
-	if host != "" {
-		docHost = host
+	if p.DocHost != "" {
+		docHost = p.DocHost
 	}
-
-	host = os.Getenv("RMAPI_AUTH")
-
-	if host != "" {
-		authHost = host
+	if p.AuthHost != "" {
+		authHost = p.AuthHost
+	}
+	if p.SyncHost != "" {
+		syncHost = p.SyncHost
 	}
-	host = os.Getenv("RMAPI_HOST")
 
-	if host != "" {
-		authHost = host
-		docHost = host
-		syncHost = host
+	if p.Host != "" {
+		authHost = p.Host
+		docHost = p.Host
+		syncHost = p.Host
 	}
 
-	NewTokenDevice = authHost + "/token/json/2/device/new"
-	NewUserDevice = authHost + "/token/json/2/user/new"
-	ListDocs = docHost + "/document-storage/json/2/docs"
-	UpdateStatus = docHost + "/document-storage/json/2/upload/update-status"
-	UploadRequest = docHost + "/document-storage/json/2/upload/request"
-	DeleteEntry = docHost + "/document-storage/json/2/delete"
+	return Urls{
+		NewTokenDevice: authHost + "/token/json/2/device/new",
+		NewUserDevice:  authHost + "/token/json/2/user/new",
+		ListDocs:       docHost + "/document-storage/json/2/docs",
+		UpdateStatus:   docHost + "/document-storage/json/2/upload/update-status",
+		UploadRequest:  docHost + "/document-storage/json/2/upload/request",
+		DeleteEntry:    docHost + "/document-storage/json/2/delete",
+
+		UploadBlob:   syncHost + "/sync/v2/signed-urls/uploads",
+		DownloadBlob: syncHost + "/sync/v2/signed-urls/downloads",
+		SyncComplete: syncHost + "/sync/v2/sync-complete",
+	}
+}
 
-	UploadBlob = syncHost + "/sync/v2/signed-urls/uploads"
-	DownloadBlob = syncHost + "/sync/v2/signed-urls/downloads"
-	SyncComplete = syncHost + "/sync/v2/sync-complete"
+// ProfileUrls returns the urls of the endpoints of the profile called name,
+// each account keeps its own so that several can be used at once
+func ProfileUrls(name string) (Urls, error) {
+	p, err := Settings(name)
+	if err != nil {
+		return Urls{}, err
+	}
+	return p.Urls(), nil
 }
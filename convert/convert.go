@@ -0,0 +1,151 @@
+// Package convert turns source files the tablet can't open natively
+// (Markdown, HTML, plain text, images, DOCX) into PDF or EPUB documents
+// before they are packed and uploaded.
+//
+// Converters are looked up by the lowercase file extension. Images become
+// one PDF page each, sized to the device, while reflowable text ends up as an EPUB.
+// Any converter can be replaced by an external command by setting
+// RMAPI_CONVERT_<EXT> (e.g. RMAPI_CONVERT_DOCX="pandoc {in} -o {out}"),
+// where {in} and {out} are replaced by the source and destination paths.
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	shlex "github.com/flynn-archive/go-shlex"
+	"github.com/juruen/rmapi/log"
+	"github.com/juruen/rmapi/util"
+)
+
+const envPrefix = "RMAPI_CONVERT_"
+
+// A Converter converts the file at srcPath into dstPath
+type Converter interface {
+	// Target returns the extension of the produced document (pdf or epub)
+	Target() string
+	Convert(srcPath, dstPath string) error
+}
+
+var converters = map[string]Converter{}
+
+func init() {
+	Register(util.PNG, ImageConverter{})
+	Register(util.JPG, ImageConverter{})
+	Register(util.JPEG, ImageConverter{})
+	Register(util.TXT, TextConverter{})
+	Register(util.MD, MarkdownConverter{})
+	Register(util.HTML, HtmlConverter{})
+	Register(util.HTM, HtmlConverter{})
+	Register(util.DOCX, &CommandConverter{TargetExt: util.EPUB, Command: "pandoc", Args: []string{"{in}", "-o", "{out}"}})
+}
+
+// Register sets the converter used for files with the given extension
+func Register(ext string, c Converter) {
+	converters[strings.ToLower(ext)] = c
+}
+
+// Lookup returns the converter for an extension, taking the
+// RMAPI_CONVERT_<EXT> overrides into account
+func Lookup(ext string) (Converter, bool) {
+	ext = strings.ToLower(ext)
+	c, ok := converters[ext]
+	if !ok {
+		return nil, false
+	}
+
+	if cmdLine := os.Getenv(envPrefix + strings.ToUpper(ext)); cmdLine != "" {
+		cmd, err := NewCommandConverter(c.Target(), cmdLine)
+		if err != nil {
+			log.Warning.Printf("ignoring %s%s: %v", envPrefix, strings.ToUpper(ext), err)
+			return c, true
+		}
+		return cmd, true
+	}
+
+	return c, true
+}
+
+// NeedsConversion returns true when files with that extension
+// have to be converted before being uploaded
+func NeedsConversion(ext string) bool {
+	_, ok := converters[strings.ToLower(ext)]
+	return ok
+}
+
+// Prepare converts sourceDocPath into tmpDir if needed and returns the path of
+// the document to upload with its extension. Documents the tablet supports
+// are returned unchanged.
+func Prepare(sourceDocPath, tmpDir string) (docPath string, ext string, err error) {
+	name, ext := util.DocPathToName(sourceDocPath)
+
+	c, ok := Lookup(ext)
+	if !ok {
+		return sourceDocPath, ext, nil
+	}
+
+	docPath = filepath.Join(tmpDir, name+"."+c.Target())
+	log.Info.Printf("converting %s to %s", sourceDocPath, docPath)
+
+	if err = c.Convert(sourceDocPath, docPath); err != nil {
+		return "", "", fmt.Errorf("failed to convert %s: %v", sourceDocPath, err)
+	}
+
+	return docPath, c.Target(), nil
+}
+
+// CommandConverter converts a file running an external command
+type CommandConverter struct {
+	TargetExt string
+	Command   string
+	// Args can contain the {in} and {out} placeholders
+	Args []string
+}
+
+// NewCommandConverter creates a converter from a command line such as "pandoc {in} -o {out}"
+func NewCommandConverter(target, cmdLine string) (*CommandConverter, error) {
+	fields, err := shlex.Split(cmdLine)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty converter command")
+	}
+
+	return &CommandConverter{TargetExt: target, Command: fields[0], Args: fields[1:]}, nil
+}
+
+func (c *CommandConverter) Target() string {
+	return c.TargetExt
+}
+
+func (c *CommandConverter) Convert(srcPath, dstPath string) error {
+	if _, err := exec.LookPath(c.Command); err != nil {
+		return fmt.Errorf("converter %s not found", c.Command)
+	}
+
+	args := make([]string, len(c.Args))
+	for i, a := range c.Args {
+		a = strings.ReplaceAll(a, "{in}", srcPath)
+		args[i] = strings.ReplaceAll(a, "{out}", dstPath)
+	}
+
+	log.Trace.Println("running converter", c.Command, args)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(c.Command, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	if _, err := os.Stat(dstPath); err != nil {
+		return fmt.Errorf("converter did not produce %s", dstPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package convert
+
+import (
+	"archive/zip"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/juruen/rmapi/util"
+	"github.com/stretchr/testify/assert"
+	pdfmodel "github.com/unidoc/unipdf/v3/model"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	md := "# Title\n\nSome *text* with `code` and a [link](http://a_b.c).\n\n- one\n- two\n\n1. first\n\n```\nx < y\n```\n"
+	expected := "<h1>Title</h1>\n" +
+		"<p>Some <em>text</em> with <code>code</code> and a <a href=\"http://a_b.c\">link</a>.</p>\n" +
+		"<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n" +
+		"<ol>\n<li>first</li>\n</ol>\n" +
+		"<pre><code>x &lt; y</code></pre>\n"
+
+	assert.Equal(t, expected, renderMarkdown(md))
+}
+
+func readEpubContent(t *testing.T, path string) (string, string) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if r.File[0].Name != "mimetype" {
+		t.Error("mimetype is not the first entry")
+	}
+
+	var mimetype, content string
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		switch f.Name {
+		case "mimetype":
+			mimetype = string(b)
+		case "OEBPS/content.xhtml":
+			content = string(b)
+		}
+	}
+	return mimetype, content
+}
+
+func TestPrepareText(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "notes.txt")
+	os.WriteFile(src, []byte("first line\nsecond & line\n\nnext paragraph"), 0600)
+
+	docPath, ext, err := Prepare(src, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, util.EPUB, ext)
+	assert.Equal(t, filepath.Join(dir, "notes.epub"), docPath)
+
+	mimetype, content := readEpubContent(t, docPath)
+	assert.Equal(t, "application/epub+zip", mimetype)
+	assert.Contains(t, content, "<p>first line<br/>\nsecond &amp; line</p>")
+	assert.Contains(t, content, "<p>next paragraph</p>")
+}
+
+func TestPrepareHtml(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "page.html")
+	os.WriteFile(src, []byte("<html><head><title>A page</title><script>x()</script></head><body><p>hello<br>world<script>y()</script></body></html>"), 0600)
+
+	docPath, _, err := Prepare(src, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, content := readEpubContent(t, docPath)
+	assert.Contains(t, content, "<title>A page</title>")
+	assert.Contains(t, content, "<p>hello<br/>world")
+	assert.False(t, strings.Contains(content, "y()"))
+}
+
+func TestPrepareImage(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "scan.png")
+	img := image.NewGray(image.Rect(0, 0, 200, 100))
+	img.SetGray(10, 10, color.Gray{0})
+	f, _ := os.Create(src)
+	png.Encode(f, img)
+	f.Close()
+
+	docPath, ext, err := Prepare(src, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, util.PDF, ext)
+
+	pdf, err := os.Open(docPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pdf.Close()
+	reader, err := pdfmodel.NewPdfReader(pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, _ := reader.GetNumPages()
+	assert.Equal(t, 1, pages)
+}
+
+func TestPrepareNative(t *testing.T) {
+	docPath, ext, err := Prepare("/some/book.PDF", "/tmp")
+	assert.Nil(t, err)
+	assert.Equal(t, "/some/book.PDF", docPath)
+	assert.Equal(t, util.PDF, ext)
+}
+
+func TestCommandOverride(t *testing.T) {
+	os.Setenv("RMAPI_CONVERT_TXT", "cp {in} {out}")
+	defer os.Unsetenv("RMAPI_CONVERT_TXT")
+
+	c, ok := Lookup("txt")
+	assert.True(t, ok)
+	cmd, ok := c.(*CommandConverter)
+	assert.True(t, ok)
+	assert.Equal(t, util.EPUB, cmd.Target())
+	assert.Equal(t, []string{"{in}", "{out}"}, cmd.Args)
+}
@@ -0,0 +1,218 @@
+package convert
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/juruen/rmapi/util"
+	xhtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const containerXml = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+const contentOpf = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="uid">urn:uuid:%s</dc:identifier>
+    <dc:title>%s</dc:title>
+    <dc:language>en</dc:language>
+    <meta property="dcterms:modified">%s</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="content" href="content.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine>
+    <itemref idref="content"/>
+  </spine>
+</package>
+`
+
+const navXhtml = `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>%[1]s</title></head>
+<body>
+  <nav epub:type="toc"><ol><li><a href="content.xhtml">%[1]s</a></li></ol></nav>
+</body>
+</html>
+`
+
+const contentXhtml = `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>%s</title></head>
+<body>
+%s
+</body>
+</html>
+`
+
+// writeEpub writes a single chapter EPUB whose body is the given XHTML fragment
+func writeEpub(dstPath, title, body string) error {
+	f, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+
+	// the mimetype has to be the first entry and can't be compressed
+	mw, err := w.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err = mw.Write([]byte("application/epub+zip")); err != nil {
+		return err
+	}
+
+	title = html.EscapeString(title)
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"META-INF/container.xml", containerXml},
+		{"OEBPS/content.opf", fmt.Sprintf(contentOpf, uuid.New().String(), title, time.Now().UTC().Format("2006-01-02T15:04:05Z"))},
+		{"OEBPS/nav.xhtml", fmt.Sprintf(navXhtml, title)},
+		{"OEBPS/content.xhtml", fmt.Sprintf(contentXhtml, title, body)},
+	}
+
+	for _, file := range files {
+		fw, err := w.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err = fw.Write([]byte(file.content)); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+// TextConverter turns a plain text file into an EPUB, blank lines separate paragraphs
+type TextConverter struct{}
+
+func (TextConverter) Target() string {
+	return util.EPUB
+}
+
+func (TextConverter) Convert(srcPath, dstPath string) error {
+	content, err := os.ReadFile(srcPath)
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		lines := strings.Split(html.EscapeString(paragraph), "\n")
+		fmt.Fprintf(&body, "<p>%s</p>\n", strings.Join(lines, "<br/>\n"))
+	}
+
+	name, _ := util.DocPathToName(srcPath)
+	return writeEpub(dstPath, name, body.String())
+}
+
+// MarkdownConverter renders a Markdown file into an EPUB
+type MarkdownConverter struct{}
+
+func (MarkdownConverter) Target() string {
+	return util.EPUB
+}
+
+func (MarkdownConverter) Convert(srcPath, dstPath string) error {
+	content, err := os.ReadFile(srcPath)
+	if err != nil {
+		return err
+	}
+
+	name, _ := util.DocPathToName(srcPath)
+	return writeEpub(dstPath, name, renderMarkdown(string(content)))
+}
+
+// HtmlConverter wraps the body of an HTML page into an EPUB.
+// The page is parsed and rendered again so that it is well formed XHTML.
+type HtmlConverter struct{}
+
+func (HtmlConverter) Target() string {
+	return util.EPUB
+}
+
+func (HtmlConverter) Convert(srcPath, dstPath string) error {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	doc, err := xhtml.Parse(f)
+	if err != nil {
+		return err
+	}
+
+	title, _ := util.DocPathToName(srcPath)
+	var body *xhtml.Node
+
+	var walk func(n *xhtml.Node)
+	walk = func(n *xhtml.Node) {
+		if n.Type == xhtml.ElementNode {
+			switch n.DataAtom {
+			case atom.Title:
+				if n.FirstChild != nil && strings.TrimSpace(n.FirstChild.Data) != "" {
+					title = strings.TrimSpace(n.FirstChild.Data)
+				}
+			case atom.Body:
+				body = n
+				return
+			case atom.Script, atom.Style:
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	var buf bytes.Buffer
+	if body != nil {
+		stripScripts(body)
+		for c := body.FirstChild; c != nil; c = c.NextSibling {
+			if err := xhtml.Render(&buf, c); err != nil {
+				return err
+			}
+		}
+	}
+
+	return writeEpub(dstPath, title, buf.String())
+}
+
+// stripScripts removes the scripts and styles found under n
+func stripScripts(n *xhtml.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == xhtml.ElementNode && (c.DataAtom == atom.Script || c.DataAtom == atom.Style) {
+			n.RemoveChild(c)
+		} else {
+			stripScripts(c)
+		}
+		c = next
+	}
+}
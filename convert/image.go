@@ -0,0 +1,42 @@
+package convert
+
+import (
+	"github.com/juruen/rmapi/annotations"
+	"github.com/juruen/rmapi/util"
+	"github.com/unidoc/unipdf/v3/creator"
+)
+
+// ImageConverter turns a PNG or JPEG image into a single page PDF
+// with the size of the device, the image is scaled to fit and centered
+type ImageConverter struct{}
+
+func (ImageConverter) Target() string {
+	return util.PDF
+}
+
+func (ImageConverter) Convert(srcPath, dstPath string) error {
+	c := creator.New()
+	c.SetPageSize(annotations.RmPageSize)
+
+	img, err := c.NewImageFromFile(srcPath)
+	if err != nil {
+		return err
+	}
+
+	pageWidth := annotations.RmPageSize[0]
+	pageHeight := annotations.RmPageSize[1]
+
+	if img.Width()/img.Height() > pageWidth/pageHeight {
+		img.ScaleToWidth(pageWidth)
+	} else {
+		img.ScaleToHeight(pageHeight)
+	}
+	img.SetPos((pageWidth-img.Width())/2, (pageHeight-img.Height())/2)
+
+	c.NewPage()
+	if err := c.Draw(img); err != nil {
+		return err
+	}
+
+	return c.WriteToFile(dstPath)
+}
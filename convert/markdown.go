@@ -0,0 +1,143 @@
+package convert
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// renderMarkdown renders the common subset of Markdown (headings, paragraphs,
+// lists, block quotes, code blocks, rules, emphasis, inline code and links)
+// into an XHTML fragment
+func renderMarkdown(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var out strings.Builder
+	var paragraph []string
+	var listTag string
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			fmt.Fprintf(&out, "<p>%s</p>\n", renderInline(strings.Join(paragraph, " ")))
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			fmt.Fprintf(&out, "</%s>\n", listTag)
+			listTag = ""
+		}
+	}
+	openList := func(tag string) {
+		if listTag != tag {
+			closeList()
+			fmt.Fprintf(&out, "<%s>\n", tag)
+			listTag = tag
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flushParagraph()
+			closeList()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			fmt.Fprintf(&out, "<pre><code>%s</code></pre>\n", html.EscapeString(strings.Join(code, "\n")))
+		case trimmed == "":
+			flushParagraph()
+			closeList()
+		case headingRe.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			m := headingRe.FindStringSubmatch(trimmed)
+			level := len(m[1])
+			fmt.Fprintf(&out, "<h%d>%s</h%d>\n", level, renderInline(strings.TrimRight(m[2], " #")), level)
+		case ruleRe.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			out.WriteString("<hr/>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			closeList()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quote = append(quote, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")))
+			}
+			i--
+			fmt.Fprintf(&out, "<blockquote>%s</blockquote>\n", renderMarkdown(strings.Join(quote, "\n")))
+		case unorderedRe.MatchString(trimmed):
+			flushParagraph()
+			openList("ul")
+			fmt.Fprintf(&out, "<li>%s</li>\n", renderInline(unorderedRe.ReplaceAllString(trimmed, "")))
+		case orderedRe.MatchString(trimmed):
+			flushParagraph()
+			openList("ol")
+			fmt.Fprintf(&out, "<li>%s</li>\n", renderInline(orderedRe.ReplaceAllString(trimmed, "")))
+		default:
+			if listTag != "" && strings.HasPrefix(line, " ") {
+				// continuation of a list item, keep it simple and append it as a new item text
+				fmt.Fprintf(&out, "<li>%s</li>\n", renderInline(trimmed))
+				continue
+			}
+			closeList()
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flushParagraph()
+	closeList()
+
+	return out.String()
+}
+
+var (
+	headingRe   = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	ruleRe      = regexp.MustCompile(`^([-*_])(\s*([-*_])){2,}$`)
+	unorderedRe = regexp.MustCompile(`^[-*+]\s+`)
+	orderedRe   = regexp.MustCompile(`^\d+[.)]\s+`)
+
+	codeRe   = regexp.MustCompile("`([^`]+)`")
+	linkRe   = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	strongRe = regexp.MustCompile(`(\*\*|__)(.+?)(\*\*|__)`)
+	emRe     = regexp.MustCompile(`(^|[^\w*])([*_])([^*_]+?)[*_]([^\w*]|$)`)
+)
+
+// renderInline renders the inline elements of a block, code spans are kept verbatim
+func renderInline(s string) string {
+	var out strings.Builder
+	last := 0
+	for _, m := range codeRe.FindAllStringSubmatchIndex(s, -1) {
+		out.WriteString(renderText(s[last:m[0]]))
+		fmt.Fprintf(&out, "<code>%s</code>", html.EscapeString(s[m[2]:m[3]]))
+		last = m[1]
+	}
+	out.WriteString(renderText(s[last:]))
+
+	return out.String()
+}
+
+func renderText(s string) string {
+	var out strings.Builder
+	last := 0
+	for _, m := range linkRe.FindAllStringSubmatchIndex(s, -1) {
+		out.WriteString(renderEmphasis(s[last:m[0]]))
+		fmt.Fprintf(&out, `<a href="%s">%s</a>`, html.EscapeString(s[m[4]:m[5]]), renderEmphasis(s[m[2]:m[3]]))
+		last = m[1]
+	}
+	out.WriteString(renderEmphasis(s[last:]))
+
+	return out.String()
+}
+
+func renderEmphasis(s string) string {
+	s = html.EscapeString(s)
+	s = strongRe.ReplaceAllString(s, "<strong>$2</strong>")
+	s = emRe.ReplaceAllString(s, "$1<em>$3</em>$4")
+	return s
+}
@@ -1,8 +1,84 @@
 package rm
 
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
 // MarshalBinary implements encoding.MarshalBinary for
 // transforming a Rm page into bytes
-// TODO
 func (rm *Rm) MarshalBinary() (data []byte, err error) {
-	return nil, nil
+	w := writer{version: rm.Version}
+
+	if err := w.writeHeader(); err != nil {
+		return nil, err
+	}
+
+	if err := w.writeNumber(uint32(len(rm.Layers))); err != nil {
+		return nil, err
+	}
+
+	for _, layer := range rm.Layers {
+		if err := w.writeNumber(uint32(len(layer.Lines))); err != nil {
+			return nil, err
+		}
+
+		for _, line := range layer.Lines {
+			if err := w.writeLine(line); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return w.Bytes(), nil
+}
+
+type writer struct {
+	bytes.Buffer
+	version Version
+}
+
+func (w *writer) writeHeader() error {
+	switch w.version {
+	case V5:
+		w.WriteString(HeaderV5)
+	case V3:
+		w.WriteString(HeaderV3)
+	default:
+		return fmt.Errorf("Unknown version")
+	}
+
+	return nil
+}
+
+func (w *writer) writeNumber(n uint32) error {
+	return binary.Write(w, binary.LittleEndian, n)
+}
+
+func (w *writer) writeLine(line Line) error {
+	fields := []interface{}{line.BrushType, line.BrushColor, line.Padding, line.BrushSize}
+
+	// this attribute has been added in v5
+	if w.version == V5 {
+		fields = append(fields, line.Unknown)
+	}
+
+	for _, f := range fields {
+		if err := binary.Write(w, binary.LittleEndian, f); err != nil {
+			return fmt.Errorf("Failed to write line")
+		}
+	}
+
+	if err := w.writeNumber(uint32(len(line.Points))); err != nil {
+		return err
+	}
+
+	for _, point := range line.Points {
+		if err := binary.Write(w, binary.LittleEndian, point); err != nil {
+			return fmt.Errorf("Failed to write point")
+		}
+	}
+
+	return nil
 }
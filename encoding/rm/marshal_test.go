@@ -0,0 +1,52 @@
+package rm
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func testMarshalBinary(t *testing.T, fn string) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Errorf("can't open %s file", fn)
+	}
+
+	rm := New()
+	if err = rm.UnmarshalBinary(b); err != nil {
+		t.Error(err)
+	}
+
+	out, err := rm.MarshalBinary()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !bytes.Equal(b, out) {
+		t.Errorf("%s: marshaled page differs from the original", fn)
+	}
+}
+
+func TestMarshalBinaryV5(t *testing.T) {
+	testMarshalBinary(t, "test_v5.rm")
+}
+
+func TestMarshalBinaryV3(t *testing.T) {
+	testMarshalBinary(t, "test_v3.rm")
+}
+
+func TestMarshalEmptyPage(t *testing.T) {
+	b, err := New().MarshalBinary()
+	if err != nil {
+		t.Error(err)
+	}
+
+	rm := &Rm{}
+	if err = rm.UnmarshalBinary(b); err != nil {
+		t.Error(err)
+	}
+
+	if rm.Version != V5 || len(rm.Layers) != 1 {
+		t.Error("wrong empty page")
+	}
+}
@@ -142,10 +142,13 @@ type Point struct {
 // New helps creating an empty Rm page.
 // By mashaling an empty Rm page and exporting it
 // to the device, we should generate an empty page
-// as if it were created using the device itself.
-// TODO
+// as if it were created using the device itself,
+// that is a v5 page with a single empty layer.
 func New() *Rm {
-	return &Rm{}
+	return &Rm{
+		Version: V5,
+		Layers:  []Layer{{Lines: []Line{}}},
+	}
 }
 
 // String implements the fmt.Stringer interface
@@ -2,6 +2,9 @@ package filetree
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/juruen/rmapi/model"
 	"github.com/juruen/rmapi/util"
@@ -108,7 +111,32 @@ func (ctx *FileTreeCtx) MoveNode(src, dst *model.Node) {
 	}
 }
 
+const (
+	// IdPrefix starts a path from the entry with the given id, e.g. id:<uuid>/notes
+	IdPrefix = "id:"
+	// DuplicateSep separates a name from the index of the entry among the ones of its
+	// directory with the same name, e.g. notes~2
+	DuplicateSep = "~"
+)
+
+// NodeByPath returns the entry of path, relative to the directory current unless it starts with /.
+// Entries can be addressed by id with IdPrefix, and duplicate names told apart with DuplicateSep.
 func (ctx *FileTreeCtx) NodeByPath(path string, current *model.Node) (*model.Node, error) {
+	if strings.HasPrefix(path, IdPrefix) {
+		id, rest := strings.TrimPrefix(path, IdPrefix), ""
+		if i := strings.Index(id, "/"); i >= 0 {
+			id, rest = id[:i], id[i+1:]
+		}
+		node := ctx.NodeById(id)
+		if node == nil {
+			return nil, errors.New("entry doesn't exist")
+		}
+		if rest == "" {
+			return node, nil
+		}
+		return ctx.NodeByPath(rest, node)
+	}
+
 	if current == nil {
 		current = ctx.Root()
 	}
@@ -143,7 +171,7 @@ func (ctx *FileTreeCtx) NodeByPath(path string, current *model.Node) (*model.Nod
 		}
 
 		var err error
-		current, err = current.FindByName(entries[i])
+		current, err = findChild(current, entries[i])
 
 		if err != nil {
 			return nil, err
@@ -179,3 +207,39 @@ func (ctx *FileTreeCtx) NodeToPath(targetNode *model.Node) (string, error) {
 		return "", errors.New("entry not found")
 	}
 }
+
+// findChild returns the child of node with the given name, or the one at the index
+// given after DuplicateSep among the children with the same name, numbered from 1
+func findChild(node *model.Node, name string) (*model.Node, error) {
+	if child, err := node.FindByName(name); err == nil {
+		return child, nil
+	}
+
+	if i := strings.LastIndex(name, DuplicateSep); i > 0 {
+		index, err := strconv.Atoi(name[i+len(DuplicateSep):])
+		children := node.ChildrenByName(name[:i])
+		if err == nil && index >= 1 && index <= len(children) {
+			return children[index-1], nil
+		}
+	}
+	return nil, errors.New("entry doesn't exist")
+}
+
+// EntryName returns the name addressing the entry in its directory, with its index
+// after DuplicateSep when other entries of the directory have the same name
+func EntryName(node *model.Node) string {
+	if node.Parent == nil {
+		return node.Name()
+	}
+
+	same := node.Parent.ChildrenByName(node.Name())
+	if len(same) < 2 {
+		return node.Name()
+	}
+	for i, n := range same {
+		if n == node {
+			return fmt.Sprintf("%s%s%d", node.Name(), DuplicateSep, i+1)
+		}
+	}
+	return node.Name()
+}
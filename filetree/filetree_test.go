@@ -150,6 +150,45 @@ func TestNodeByPath(t *testing.T) {
 	assert.Equal(t, "file1", node.Name())
 }
 
+func TestNodeByPathDuplicates(t *testing.T) {
+	ctx := CreateFileTreeCtx()
+
+	// dir1/notes twice and dir1/notes~2
+	ctx.AddDocument(createDirectory("1", "", "dir1"))
+	ctx.AddDocument(createFile("b", "1", "notes"))
+	ctx.AddDocument(createFile("a", "1", "notes"))
+	ctx.AddDocument(createFile("c", "1", "other~2"))
+
+	node, err := ctx.NodeByPath("dir1/notes", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", node.Id())
+
+	node, err = ctx.NodeByPath("dir1/notes~2", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", node.Id())
+	assert.Equal(t, "notes~2", EntryName(node))
+
+	_, err = ctx.NodeByPath("dir1/notes~3", nil)
+	assert.Error(t, err)
+
+	// an entry named like a duplicate is found by its name
+	node, err = ctx.NodeByPath("dir1/other~2", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "c", node.Id())
+	assert.Equal(t, "other~2", EntryName(node))
+
+	node, err = ctx.NodeByPath("id:b", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", node.Id())
+
+	node, err = ctx.NodeByPath("id:1/notes~1", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", node.Id())
+
+	_, err = ctx.NodeByPath("id:missing", nil)
+	assert.Error(t, err)
+}
+
 func TestNodeToPath(t *testing.T) {
 	ctx := CreateFileTreeCtx()
 
@@ -0,0 +1,99 @@
+package filetree
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/juruen/rmapi/model"
+	"github.com/juruen/rmapi/util"
+)
+
+// HasGlob tells if a path has glob metacharacters
+func HasGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// Glob returns the entries matching pattern from the directory current, sorted by path.
+// Each element of the pattern is matched with path.Match, so *, ? and character classes
+// are supported and a backslash escapes the next character, e.g. an escaped space.
+// ** matches any number of directories, none included. A pattern starting with IdPrefix
+// is expanded from the entry with that id, e.g. id:<uuid>/*.
+func (ctx *FileTreeCtx) Glob(pattern string, current *model.Node) ([]*model.Node, error) {
+	if strings.HasPrefix(pattern, IdPrefix) {
+		id, rest := strings.TrimPrefix(pattern, IdPrefix), ""
+		if i := strings.Index(id, "/"); i >= 0 {
+			id, rest = id[:i], id[i+1:]
+		}
+		current = ctx.NodeById(id)
+		if current == nil {
+			return []*model.Node{}, nil
+		}
+		pattern = rest
+	}
+
+	if current == nil {
+		current = ctx.Root()
+	}
+
+	elements := util.SplitPath(pattern)
+	if len(elements) > 0 && elements[0] == "" {
+		current = ctx.Root()
+	}
+	for _, e := range elements {
+		if _, err := path.Match(e, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	matches := make(map[*model.Node]string)
+	glob(current, "", elements, matches)
+
+	paths := make([]string, 0, len(matches))
+	nodes := make(map[string]*model.Node)
+	for n, p := range matches {
+		// entries with the same path are told apart by their id
+		p += "\x00" + n.Id()
+		paths = append(paths, p)
+		nodes[p] = n
+	}
+	sort.Strings(paths)
+
+	result := make([]*model.Node, 0, len(paths))
+	for _, p := range paths {
+		result = append(result, nodes[p])
+	}
+	return result, nil
+}
+
+// glob adds the entries under node matching the elements of a pattern, with their path
+func glob(node *model.Node, nodePath string, elements []string, matches map[*model.Node]string) {
+	if len(elements) == 0 {
+		matches[node] = nodePath
+		return
+	}
+
+	element, rest := elements[0], elements[1:]
+	switch element {
+	case "", ".":
+		glob(node, nodePath, rest, matches)
+	case "..":
+		if node.Parent != nil {
+			node = node.Parent
+		}
+		glob(node, path.Join(nodePath, ".."), rest, matches)
+	case "**":
+		glob(node, nodePath, rest, matches)
+		for _, c := range node.Children {
+			if c.IsDirectory() {
+				glob(c, path.Join(nodePath, c.Name()), elements, matches)
+			}
+		}
+	default:
+		for _, c := range node.Children {
+			if ok, _ := path.Match(element, c.Name()); ok {
+				glob(c, path.Join(nodePath, c.Name()), rest, matches)
+			}
+		}
+	}
+}
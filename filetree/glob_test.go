@@ -0,0 +1,49 @@
+package filetree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func globNames(t *testing.T, ctx *FileTreeCtx, pattern string) []string {
+	nodes, err := ctx.Glob(pattern, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		names = append(names, n.Name())
+	}
+	return names
+}
+
+func TestGlob(t *testing.T) {
+	ctx := CreateFileTreeCtx()
+	ctx.AddDocument(createDirectory("1", "", "Inbox"))
+	ctx.AddDocument(createFile("2", "1", "a.pdf"))
+	ctx.AddDocument(createFile("3", "1", "b.pdf"))
+	ctx.AddDocument(createFile("4", "1", "notes"))
+	ctx.AddDocument(createDirectory("5", "1", "old"))
+	ctx.AddDocument(createFile("6", "5", "c.pdf"))
+	ctx.AddDocument(createFile("7", "", "my file"))
+
+	assert.Equal(t, []string{"a.pdf", "b.pdf"}, globNames(t, &ctx, "Inbox/*.pdf"))
+	assert.Equal(t, []string{"a.pdf", "b.pdf", "c.pdf"}, globNames(t, &ctx, "**/*.pdf"))
+	assert.Equal(t, []string{"a.pdf"}, globNames(t, &ctx, "/Inbox/[a].pdf"))
+	assert.Equal(t, []string{"a.pdf", "b.pdf"}, globNames(t, &ctx, "Inbox/?.pdf"))
+	assert.Equal(t, []string{"a.pdf", "b.pdf", "notes", "old"}, globNames(t, &ctx, "Inbox/*"))
+	assert.Equal(t, []string{"my file"}, globNames(t, &ctx, "my\\ f*"))
+	assert.Empty(t, globNames(t, &ctx, "Inbox/*.epub"))
+	assert.Equal(t, []string{"a.pdf", "b.pdf"}, globNames(t, &ctx, "id:1/*.pdf"))
+	assert.Equal(t, []string{"c.pdf"}, globNames(t, &ctx, "id:5/*"))
+	assert.Empty(t, globNames(t, &ctx, "id:missing/*"))
+
+	nodes, err := ctx.Glob("*.pdf", ctx.NodeById("5"))
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 1)
+
+	_, err = ctx.Glob("Inbox/[", nil)
+	assert.Error(t, err)
+}
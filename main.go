@@ -6,21 +6,32 @@ import (
 	"os"
 
 	"github.com/juruen/rmapi/api"
+	"github.com/juruen/rmapi/api/usb"
+	"github.com/juruen/rmapi/auth"
 	"github.com/juruen/rmapi/config"
 	"github.com/juruen/rmapi/log"
 	"github.com/juruen/rmapi/shell"
 	"github.com/juruen/rmapi/version"
 )
 
-const AUTH_RETRIES = 3
-
-func parseOfflineCommands(cmd []string) bool {
+func parseOfflineCommands(cmd []string, profile string, nonInteractive bool) bool {
 	if len(cmd) == 0 {
 		return false
 	}
 
 	switch cmd[0] {
 	case "reset":
+		store, err := api.ProfileTokenStore(profile, true)
+		if err != nil {
+			log.Error.Fatalln(err)
+		}
+		if err = auth.Reset(store); err != nil {
+			log.Error.Fatalln(err)
+		}
+		// only the tokens of a profile are removed, the other profiles are kept
+		if profile != "" {
+			return true
+		}
 		configFile, err := config.ConfigPath()
 		if err != nil {
 			log.Error.Fatalln(err)
@@ -32,54 +43,102 @@ func parseOfflineCommands(cmd []string) bool {
 	case "version":
 		fmt.Println(version.Version)
 		return true
+	case "auth":
+		if err := authCommand(cmd[1:], profile, nonInteractive); err != nil {
+			log.Error.Fatalln(err)
+		}
+		return true
 	}
 	return false
 }
 
 func main() {
 	ni := flag.Bool("ni", false, "not interactive (prevents asking for code)")
+	profile := flag.String("profile", os.Getenv("RMAPI_PROFILE"), "profile of the config file to use, each one has its own tokens and settings")
+	backend := flag.String("backend", "", "where the documents are: cloud, local or usb (default from the profile or cloud)")
+	dir := flag.String("dir", "", "directory with a copy of the documents of the tablet for the local backend")
+	dryRun := flag.Bool("dry-run", false, "print what the commands would change in the account instead of changing it (cloud only)")
+	script := flag.String("f", "", "run the commands of a script file, - for the standard input")
+	usbHost := flag.String("usb-host", "", "address of the tablet for the usb backend (default "+usb.DefaultHost+")")
 	flag.Usage = func() {
 		fmt.Println(`
   help		detailed commands, but the user needs to be logged in
 
+  Commands given after the flags are run instead of opening the shell, and
+  the ones of a script with -f or piped to the standard input in batch mode.
+
 Offline Commands:
   version	prints the version
-  reset		removes the config file `)
+  auth		login, status, refresh or logout, manages the tokens without opening the shell
+  reset		removes the config file, or only the tokens of the profile given with -profile `)
 
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 	otherFlags := flag.Args()
-	if parseOfflineCommands(otherFlags) {
+	if parseOfflineCommands(otherFlags, *profile, *ni) {
 		return
 	}
 
+	if err := config.UseProfile(*profile); err != nil {
+		log.Error.Fatal(err)
+	}
+	settings := config.Active()
+	if *backend == "" {
+		*backend = settings.Backend
+	}
+	if *dir == "" {
+		*dir = settings.Dir
+	}
+	if *usbHost == "" {
+		*usbHost = settings.UsbHost
+	}
+	if *usbHost == "" {
+		*usbHost = usb.DefaultHost
+	}
+
 	var ctx api.ApiCtx
 	var err error
 	var userInfo *api.UserInfo
 
-	for i := 0; i < AUTH_RETRIES; i++ {
-		authCtx := api.AuthHttpCtx(i > 0, *ni)
-
-		userInfo, err = api.ParseToken(authCtx.Tokens.UserToken)
-		if err != nil {
-			log.Trace.Println(err)
-			continue
+	switch *backend {
+	case "cloud":
+		ctx, userInfo, err = api.CreateCloudApiCtx(*profile, *ni)
+	case "local":
+		if *dir == "" {
+			log.Error.Fatal("the local backend needs a directory, use -dir")
 		}
+		ctx, userInfo, err = api.CreateLocalApiCtx(*dir)
+	case "usb":
+		ctx, userInfo, err = api.CreateUsbApiCtx(*usbHost)
+	default:
+		log.Error.Fatal("unknown backend: ", *backend)
+	}
+
+	if err != nil {
+		log.Error.Fatal("failed to build documents tree, last error: ", err)
+	}
 
-		ctx, err = api.CreateApiCtx(authCtx, userInfo.SyncVersion)
+	if *dryRun {
+		dryRunCtx, err := api.NewDryRunCtx(ctx, os.Stdout)
 		if err != nil {
-			log.Trace.Println(err)
-		} else {
-			break
+			log.Error.Fatal(err)
 		}
+		ctx = dryRunCtx
 	}
 
-	if err != nil {
-		log.Error.Fatal("failed to build documents tree, last error: ", err)
+	// commands piped to rmapi are run like a script
+	if *script == "" && len(otherFlags) == 0 {
+		if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice == 0 {
+			*script = "-"
+		}
 	}
 
-	err = shell.RunShell(ctx, userInfo, otherFlags)
+	if *script != "" {
+		err = shell.RunScript(ctx, userInfo, *script)
+	} else {
+		err = shell.RunShell(ctx, userInfo, otherFlags)
+	}
 
 	if err != nil {
 		log.Error.Println("Error: ", err)
@@ -24,6 +24,11 @@ type Document struct {
 	CurrentPage       int
 	Bookmarked        bool
 	Parent            string
+	// Size is the total size of the files of the document, when known
+	Size int64 `json:",omitempty"`
+	// FileType is pdf, epub or empty for a notebook, and PageCount the number of pages, when known
+	FileType  string `json:",omitempty"`
+	PageCount int    `json:",omitempty"`
 }
 
 type MetadataDocument struct {
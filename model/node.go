@@ -2,6 +2,7 @@ package model
 
 import (
 	"errors"
+	"sort"
 	"time"
 )
 
@@ -47,11 +48,22 @@ func (node *Node) LastModified() (time.Time, error) {
 	return time.Parse(time.RFC3339Nano, node.Document.ModifiedClient)
 }
 
+// FindByName returns the child named name, the first by id when several children have that name
 func (node *Node) FindByName(name string) (*Node, error) {
+	if children := node.ChildrenByName(name); len(children) > 0 {
+		return children[0], nil
+	}
+	return nil, errors.New("entry doesn't exist")
+}
+
+// ChildrenByName returns the children named name sorted by id, the reMarkable allows duplicate names
+func (node *Node) ChildrenByName(name string) []*Node {
+	children := make([]*Node, 0, 1)
 	for _, n := range node.Children {
 		if n.Name() == name {
-			return n, nil
+			children = append(children, n)
 		}
 	}
-	return nil, errors.New("entry doesn't exist")
+	sort.Slice(children, func(i, j int) bool { return children[i].Id() < children[j].Id() })
+	return children
 }
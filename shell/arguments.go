@@ -1,6 +1,14 @@
 package shell
 
-import "strings"
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/juruen/rmapi/filetree"
+)
 
 func parseArguments(line string) []string {
 	words := [][]rune{}
@@ -56,3 +64,77 @@ func escapeSpaces(s string) string {
 func unescapeSpaces(s string) string {
 	return strings.Replace(s, "\\ ", " ", -1)
 }
+
+// parseFlags parses the flags of a command allowing them to appear
+// after positional arguments, e.g. "mknote name --pages 3"
+func parseFlags(flagSet *flag.FlagSet, args []string) ([]string, error) {
+	positional := make([]string, 0)
+
+	for {
+		if err := flagSet.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flagSet.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	return positional, nil
+}
+
+// parsePageMap parses a comma separated list with the page of the original document
+// matching each page of a new one, e.g. "1-3,-,4" for a page inserted after the third.
+// Pages are numbered from 1 and the result is zero based with -1 for no match.
+func parsePageMap(spec string) ([]int, error) {
+	matches := make([]int, 0)
+
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "-" {
+			matches = append(matches, -1)
+			continue
+		}
+
+		from, to := item, item
+		if i := strings.Index(item, "-"); i > 0 {
+			from, to = item[:i], item[i+1:]
+		}
+
+		first, err := strconv.Atoi(from)
+		if err != nil || first < 1 {
+			return nil, fmt.Errorf("invalid page %q", item)
+		}
+		last, err := strconv.Atoi(to)
+		if err != nil || last < first {
+			return nil, fmt.Errorf("invalid page range %q", item)
+		}
+
+		for p := first; p <= last; p++ {
+			matches = append(matches, p-1)
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, errors.New("empty page map")
+	}
+
+	return matches, nil
+}
+
+// splitProfilePath splits an argument of the form profile:path, the profile is empty
+// when the argument is only a path, which can start with id:
+func splitProfilePath(arg string) (profile, path string) {
+	if strings.HasPrefix(arg, filetree.IdPrefix) {
+		return "", arg
+	}
+
+	i := strings.Index(arg, ":")
+	if i <= 0 || strings.ContainsAny(arg[:i], `/\`) {
+		return "", arg
+	}
+
+	return arg[:i], arg[i+1:]
+}
@@ -1,6 +1,7 @@
 package shell
 
 import (
+	"flag"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,3 +13,48 @@ func TestParseArguments(t *testing.T) {
 	assert.Equal(t, []string{"foo", "bar\\ baz"}, parseArguments(" foo  bar\\ baz  "))
 	assert.Equal(t, []string{"foo", "bar\\ baz", "bax"}, parseArguments(" foo  bar\\ baz bax"))
 }
+
+func TestParseFlags(t *testing.T) {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	pages := flagSet.Int("pages", 1, "")
+	force := flagSet.Bool("force", false, "")
+
+	args, err := parseFlags(flagSet, []string{"name", "--pages", "3", "other", "-force"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"name", "other"}, args)
+	assert.Equal(t, 3, *pages)
+	assert.True(t, *force)
+}
+
+func TestParsePageMap(t *testing.T) {
+	matches, err := parsePageMap("1-3, -,5")
+	assert.Nil(t, err)
+	assert.Equal(t, []int{0, 1, 2, -1, 4}, matches)
+
+	_, err = parsePageMap("0")
+	assert.NotNil(t, err)
+	_, err = parsePageMap("3-1")
+	assert.NotNil(t, err)
+}
+
+func TestSplitProfilePath(t *testing.T) {
+	profile, path := splitProfilePath("teaching:/Courses/Math")
+	assert.Equal(t, "teaching", profile)
+	assert.Equal(t, "/Courses/Math", path)
+
+	profile, path = splitProfilePath("/Notes/a:b")
+	assert.Equal(t, "", profile)
+	assert.Equal(t, "/Notes/a:b", path)
+
+	profile, path = splitProfilePath("Notes")
+	assert.Equal(t, "", profile)
+	assert.Equal(t, "Notes", path)
+
+	profile, path = splitProfilePath("id:1234/Notes")
+	assert.Equal(t, "", profile)
+	assert.Equal(t, "id:1234/Notes", path)
+
+	profile, path = splitProfilePath("teaching:id:1234")
+	assert.Equal(t, "teaching", profile)
+	assert.Equal(t, "id:1234", path)
+}
@@ -0,0 +1,108 @@
+package shell
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/abiosoft/ishell"
+	"github.com/juruen/rmapi/api"
+)
+
+var errNoBackup = errors.New("backups are only supported with the sync 1.5 API")
+
+func backupCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name:      "backup",
+		Help:      "save every document of the account into a directory or a .zip file, usage: backup dst",
+		Completer: createFsEntryCompleter(),
+		Func: func(c *ishell.Context) {
+			if len(c.Args) != 1 {
+				c.Err(errors.New("missing destination"))
+				return
+			}
+
+			b, ok := ctx.api.(api.BackupCtx)
+			if !ok {
+				c.Err(errNoBackup)
+				return
+			}
+
+			c.Printf("backing up to [%s]...", c.Args[0])
+			manifest, err := b.Backup(c.Args[0])
+			if err != nil {
+				c.Err(fmt.Errorf("backup failed: %v", err))
+				return
+			}
+
+			c.Printf("OK, %d documents, generation %d\n", manifest.Documents, manifest.Generation)
+
+			// the account was refreshed before the backup
+			if err = ctx.reloadNode(); err != nil {
+				c.Err(err)
+				c.SetPrompt(ctx.prompt())
+			}
+		},
+	}
+}
+
+func restoreCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name:      "restore",
+		Help:      "upload the documents of a backup missing in the account, usage: restore [--dry-run] [--to dir] backup [path...]",
+		Completer: createFsEntryCompleter(),
+		Func: func(c *ishell.Context) {
+			flagSet := flag.NewFlagSet("restore", flag.ContinueOnError)
+			dryRun := flagSet.Bool("dry-run", false, "only list the documents that would be restored")
+			to := flagSet.String("to", "", "directory where the documents are restored")
+
+			args, err := parseFlags(flagSet, c.Args)
+			if err != nil {
+				if err != flag.ErrHelp {
+					c.Err(err)
+				}
+				return
+			}
+
+			if len(args) == 0 {
+				c.Err(errors.New("missing backup"))
+				return
+			}
+
+			b, ok := ctx.api.(api.BackupCtx)
+			if !ok {
+				c.Err(errNoBackup)
+				return
+			}
+
+			targetId := ""
+			if *to != "" {
+				node, err := ctx.api.Filetree().NodeByPath(*to, ctx.node)
+				if err != nil || node.IsFile() {
+					c.Err(errors.New("directory doesn't exist"))
+					return
+				}
+				targetId = node.Id()
+			}
+
+			documents, err := b.Restore(args[0], targetId, args[1:], *dryRun)
+			// the account is refreshed before restoring, even when nothing is restored
+			if reloadErr := ctx.reloadNode(); reloadErr != nil {
+				c.SetPrompt(ctx.prompt())
+			}
+			if err != nil {
+				c.Err(fmt.Errorf("restore failed: %v", err))
+				return
+			}
+
+			for _, d := range documents {
+				c.Println(d.VissibleName)
+			}
+			if *dryRun {
+				c.Printf("%d documents would be restored\n", len(documents))
+				return
+			}
+			c.Printf("%d documents restored\n", len(documents))
+		},
+	}
+}
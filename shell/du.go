@@ -0,0 +1,78 @@
+package shell
+
+import (
+	"errors"
+	"flag"
+	"path"
+	"sort"
+
+	"github.com/abiosoft/ishell"
+	"github.com/juruen/rmapi/filetree"
+	"github.com/juruen/rmapi/model"
+)
+
+func duCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name:      "du",
+		Help:      "print the size of the files of each directory, usage: du [-s] [dir...]",
+		Completer: createDirCompleter(ctx),
+		Func: func(c *ishell.Context) {
+			flagSet := flag.NewFlagSet("du", flag.ContinueOnError)
+			summary := flagSet.Bool("s", false, "only print the total of each directory given")
+
+			args, err := parseFlags(flagSet, c.Args)
+			if err != nil {
+				if err != flag.ErrHelp {
+					c.Err(err)
+				}
+				return
+			}
+
+			targets := []*model.Node{ctx.node}
+			if len(args) > 0 {
+				if targets, err = ctx.resolveTargets(args); err != nil {
+					c.Err(err)
+					return
+				}
+			}
+
+			for _, node := range targets {
+				if node.IsFile() {
+					c.Err(errors.New("du only takes directories"))
+					return
+				}
+				dirPath, err := ctx.api.Filetree().NodeToPath(node)
+				if err != nil {
+					dirPath = node.Name()
+				}
+				printDirSizes(c, node, dirPath, *summary)
+			}
+		},
+	}
+}
+
+// printDirSizes prints the size of a directory after the ones of its subdirectories,
+// which are skipped with summary. It returns the size of the directory.
+func printDirSizes(c *ishell.Context, dir *model.Node, dirPath string, summary bool) int64 {
+	subdirs := make([]*model.Node, 0)
+	size := dir.Document.Size
+	for _, e := range dir.Children {
+		if e.IsDirectory() {
+			subdirs = append(subdirs, e)
+		} else {
+			size += e.Document.Size
+		}
+	}
+	sort.Slice(subdirs, func(i, j int) bool { return filetree.EntryName(subdirs[i]) < filetree.EntryName(subdirs[j]) })
+
+	for _, d := range subdirs {
+		if summary {
+			size += nodeSize(d)
+			continue
+		}
+		size += printDirSizes(c, d, path.Join(dirPath, filetree.EntryName(d)), false)
+	}
+
+	c.Printf("%9s\t%s\n", formatSize(size), dirPath)
+	return size
+}
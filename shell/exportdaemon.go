@@ -0,0 +1,455 @@
+package shell
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/ishell"
+	"github.com/juruen/rmapi/annotations"
+	"github.com/juruen/rmapi/api"
+	"github.com/juruen/rmapi/archive"
+	"github.com/juruen/rmapi/config"
+	"github.com/juruen/rmapi/filetree"
+	"github.com/juruen/rmapi/log"
+	"github.com/juruen/rmapi/model"
+	"github.com/juruen/rmapi/util"
+)
+
+// exportStateFile is kept in the export directory so the daemon survives restarts
+const exportStateFile = ".rmapi-export.json"
+
+// exportState is what export-daemon knows about the documents it has seen, by id
+type exportState struct {
+	Documents map[string]*exportedDoc `json:"documents"`
+}
+
+type exportedDoc struct {
+	// Key is the hash of the document, or its version for the backends without hashes.
+	// It's empty when the export failed, so the document is tried again on the next pass.
+	Key string `json:"key"`
+	// Path is the PDF relative to the export directory, empty when the document is filtered out
+	Path string `json:"path,omitempty"`
+	// Error is why the PDF couldn't be generated
+	Error string `json:"error,omitempty"`
+}
+
+// exportDaemon keeps a directory of annotated PDFs in sync with the account
+type exportDaemon struct {
+	ctx     *ShellCtxt
+	printf  func(format string, a ...interface{})
+	dir     string
+	prefix  string
+	tag     string
+	options annotations.PdfGeneratorOptions
+	state   exportState
+}
+
+func exportDaemonCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name: "export-daemon",
+		Help: "keep a directory of annotated PDFs in sync with the account until interrupted, usage: export-daemon --to dir [--filter path|tag:name] [--interval 5m] [--once] [-p] [-a] [-n]",
+		Func: func(c *ishell.Context) {
+			flagSet := flag.NewFlagSet("export-daemon", flag.ContinueOnError)
+			defaults := config.Active().Export
+			to := flagSet.String("to", "", "directory of the PDFs")
+			filter := flagSet.String("filter", "", "only export the documents under a directory, or with a tag given as tag:name")
+			interval := flagSet.Duration("interval", 5*time.Minute, "time between two checks of the account")
+			once := flagSet.Bool("once", false, "export once and exit")
+			addPageNumbers := flagSet.Bool("p", defaults.PageNumbers, "add page numbers")
+			allPages := flagSet.Bool("a", defaults.AllPages, "all pages")
+			annotationsOnly := flagSet.Bool("n", defaults.AnnotationsOnly, "annotations only")
+
+			if _, err := parseFlags(flagSet, c.Args); err != nil {
+				if err != flag.ErrHelp {
+					c.Err(err)
+				}
+				return
+			}
+
+			if *to == "" {
+				c.Err(errors.New("missing directory, use --to"))
+				return
+			}
+			if *interval <= 0 {
+				c.Err(errors.New("the interval should be positive"))
+				return
+			}
+
+			d := &exportDaemon{
+				ctx:     ctx,
+				printf:  c.Printf,
+				dir:     *to,
+				prefix:  "/",
+				options: annotations.PdfGeneratorOptions{AddPageNumbers: *addPageNumbers, AllPages: *allPages, AnnotationsOnly: *annotationsOnly},
+			}
+			if strings.HasPrefix(*filter, "tag:") {
+				d.tag = strings.TrimPrefix(*filter, "tag:")
+			} else if *filter != "" {
+				node, err := ctx.api.Filetree().NodeByPath(*filter, ctx.node)
+				if err != nil || node.IsFile() {
+					c.Err(errors.New("directory doesn't exist"))
+					return
+				}
+				d.prefix = nodePath(node)
+			}
+
+			if err := os.MkdirAll(d.dir, 0755); err != nil {
+				c.Err(err)
+				return
+			}
+			if err := d.loadState(); err != nil {
+				c.Err(err)
+				return
+			}
+
+			interrupt := make(chan os.Signal, 1)
+			signal.Notify(interrupt, os.Interrupt)
+			defer signal.Stop(interrupt)
+
+			ticker := time.NewTicker(*interval)
+			defer ticker.Stop()
+
+			for first := true; ; first = false {
+				err := d.export(!first)
+				// the current directory may be gone
+				c.SetPrompt(ctx.prompt())
+				if err != nil {
+					if *once {
+						c.Err(err)
+						return
+					}
+					// the next pass may succeed, e.g. after a network error
+					log.Warning.Println("export failed:", err)
+				}
+				if *once {
+					return
+				}
+
+				select {
+				case <-interrupt:
+					return
+				case <-ticker.C:
+				}
+			}
+		},
+	}
+}
+
+// exportPath returns the path of the PDF of a document relative to the export directory.
+// The names come from the account, so a / in a name is replaced and . and .. are refused.
+func exportPath(node *model.Node) (string, error) {
+	names := make([]string, 0)
+	for n := node; n != nil && !n.IsRoot(); n = n.Parent {
+		name := n.Name()
+		if name == "" || name == "." || name == ".." {
+			return "", fmt.Errorf("invalid name %q in %s", name, nodePath(node))
+		}
+		names = append([]string{strings.NewReplacer("/", "_", "\\", "_").Replace(name)}, names...)
+	}
+	return strings.Join(names, "/") + ".pdf", nil
+}
+
+// nodePath returns the absolute path of a node
+func nodePath(node *model.Node) string {
+	names := make([]string, 0)
+	for n := node; n != nil && !n.IsRoot(); n = n.Parent {
+		names = append([]string{n.Name()}, names...)
+	}
+	return "/" + strings.Join(names, "/")
+}
+
+func (d *exportDaemon) statePath() string {
+	return filepath.Join(d.dir, exportStateFile)
+}
+
+func (d *exportDaemon) loadState() error {
+	d.state = exportState{Documents: make(map[string]*exportedDoc)}
+
+	content, err := ioutil.ReadFile(d.statePath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(content, &d.state); err != nil {
+		return fmt.Errorf("corrupt state file %s: %v", d.statePath(), err)
+	}
+	if d.state.Documents == nil {
+		d.state.Documents = make(map[string]*exportedDoc)
+	}
+	return nil
+}
+
+func (d *exportDaemon) saveState() error {
+	content, err := json.MarshalIndent(d.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(d.statePath(), content, 0644)
+}
+
+// export does one pass: it regenerates the PDFs of the documents that changed and
+// removes the ones of the documents that are gone. refresh gets the remote changes first.
+func (d *exportDaemon) export(refresh bool) error {
+	if refresh {
+		if err := d.refresh(); err != nil {
+			return err
+		}
+	}
+
+	// the documents are sorted so two documents with the same name keep their files
+	docs := make([]*model.Node, 0)
+	filetree.WalkTree(d.ctx.api.Filetree().Root(), filetree.FileTreeVistor{
+		Visit: func(node *model.Node, _ []string) bool {
+			if node.IsDirectory() || !d.ctx.useHiddenFiles && strings.HasPrefix(node.Name(), ".") {
+				return filetree.ContinueVisiting
+			}
+			if d.prefix != "/" && !strings.HasPrefix(nodePath(node), d.prefix+"/") {
+				return filetree.ContinueVisiting
+			}
+			docs = append(docs, node)
+			return filetree.ContinueVisiting
+		},
+	})
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Id() < docs[j].Id() })
+
+	hashes, _ := d.ctx.api.(api.HashCtx)
+	seen := make(map[string]bool)
+	taken := make(map[string]bool)
+
+	for _, node := range docs {
+		id := node.Id()
+		seen[id] = true
+
+		key := fmt.Sprintf("%d-%s", node.Document.Version, node.Document.ModifiedClient)
+		if hashes != nil {
+			var err error
+			if key, err = hashes.DocumentHash(id); err != nil {
+				return err
+			}
+		}
+
+		rel, err := exportPath(node)
+		if err != nil {
+			log.Warning.Println("skipping document:", err)
+			continue
+		}
+		if taken[rel] {
+			rel = fmt.Sprintf("%s-%s.pdf", strings.TrimSuffix(rel, ".pdf"), id)
+		}
+		taken[rel] = true
+		if _, err = d.localPath(rel); err != nil {
+			log.Warning.Println("skipping document:", err)
+			continue
+		}
+
+		if err = d.exportDoc(node, key, rel); err != nil {
+			return err
+		}
+	}
+
+	for id, doc := range d.state.Documents {
+		if seen[id] {
+			continue
+		}
+		if doc.Path != "" {
+			d.printf("removing [%s]\n", doc.Path)
+			d.remove(doc.Path)
+		}
+		delete(d.state.Documents, id)
+	}
+
+	return d.saveState()
+}
+
+func (d *exportDaemon) refresh() error {
+	if w, ok := d.ctx.api.(api.WatchCtx); ok {
+		// only mirrors the tree when the account changed
+		if _, err := w.Changes(); err != nil {
+			return err
+		}
+	} else if err := d.ctx.api.Refresh(); err != nil {
+		return err
+	}
+
+	d.ctx.reloadNode()
+	return nil
+}
+
+// exportDoc generates the PDF rel of a document when its key changed, or moves it
+// when only its path changed. Only a failure to save the state is returned, the
+// errors of a document are kept in the state.
+func (d *exportDaemon) exportDoc(node *model.Node, key, rel string) error {
+	prev, ok := d.state.Documents[node.Id()]
+	if ok && prev.Key == key {
+		if prev.Path == "" || prev.Path == rel {
+			return nil
+		}
+		d.printf("moving [%s] to [%s]\n", prev.Path, rel)
+		if err := d.move(prev.Path, rel); err != nil {
+			log.Warning.Println("failed to move the export:", err)
+			return nil
+		}
+		prev.Path = rel
+		return d.saveState()
+	}
+
+	doc := &exportedDoc{Key: key}
+	if ok {
+		// keep the previous PDF until the new one is there
+		doc.Path = prev.Path
+	}
+	d.state.Documents[node.Id()] = doc
+
+	exported, err := d.generate(node, rel)
+	switch {
+	case err != nil:
+		log.Warning.Printf("failed to export %s: %v", rel, err)
+		doc.Key = ""
+		doc.Error = err.Error()
+	case !exported:
+		if doc.Path != "" {
+			d.remove(doc.Path)
+		}
+		doc.Path = ""
+	default:
+		d.printf("exported [%s]\n", rel)
+		if doc.Path != "" && doc.Path != rel {
+			d.remove(doc.Path)
+		}
+		doc.Path = rel
+	}
+
+	return d.saveState()
+}
+
+// generate downloads a document and writes its annotated PDF at rel,
+// it returns false when the document doesn't have the tag of the filter
+func (d *exportDaemon) generate(node *model.Node, rel string) (bool, error) {
+	tmpDir, err := ioutil.TempDir("", "rmapi-export")
+	if err != nil {
+		return false, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	zipName := filepath.Join(tmpDir, "doc.zip")
+	if err = d.ctx.api.FetchDocument(node.Id(), zipName); err != nil {
+		return false, err
+	}
+
+	if d.tag != "" {
+		tagged, err := hasTag(zipName, d.tag)
+		if err != nil || !tagged {
+			return false, err
+		}
+	}
+
+	pdfName := filepath.Join(tmpDir, "doc.pdf")
+	if err = annotations.CreatePdfGenerator(zipName, pdfName, d.options).Generate(); err != nil {
+		return false, err
+	}
+
+	return true, d.move(pdfName, rel)
+}
+
+// hasTag tells whether the document in the archive zipName, or one of its pages, has the tag
+func hasTag(zipName, tag string) (bool, error) {
+	f, err := os.Open(zipName)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	zip := archive.NewZip()
+	if err = zip.Read(f, fi.Size()); err != nil {
+		return false, err
+	}
+
+	for _, t := range zip.Content.Tags {
+		if t.Name == tag {
+			return true, nil
+		}
+	}
+	for _, t := range zip.Content.PageTags {
+		if t.Name == tag {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// localPath returns the file of the export rel, which has to be inside the export directory
+func (d *exportDaemon) localPath(rel string) (string, error) {
+	file := filepath.Join(d.dir, filepath.FromSlash(rel))
+	inside, err := filepath.Rel(d.dir, file)
+	if err != nil || inside == "." || inside == ".." || strings.HasPrefix(inside, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of the export directory", rel)
+	}
+	return file, nil
+}
+
+// move moves src, relative to the export directory unless absolute, to rel
+func (d *exportDaemon) move(src, rel string) error {
+	if !filepath.IsAbs(src) {
+		var err error
+		if src, err = d.localPath(src); err != nil {
+			return err
+		}
+	}
+	dst, err := d.localPath(rel)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	if err = os.Rename(src, dst); err != nil {
+		// the temporary directory can be on another device
+		content, readErr := ioutil.ReadFile(src)
+		if readErr != nil {
+			return err
+		}
+		return ioutil.WriteFile(dst, content, 0644)
+	}
+
+	d.removeEmptyDirs(filepath.Dir(src))
+	return nil
+}
+
+// remove removes the export rel and the directories left empty
+func (d *exportDaemon) remove(rel string) {
+	file, err := d.localPath(rel)
+	if err != nil {
+		log.Warning.Println("not removing the export:", err)
+		return
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		log.Warning.Println("failed to remove the export:", err)
+	}
+	d.removeEmptyDirs(filepath.Dir(file))
+}
+
+func (d *exportDaemon) removeEmptyDirs(dir string) {
+	root := filepath.Clean(d.dir)
+	for dir = filepath.Clean(dir); strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
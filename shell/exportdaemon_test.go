@@ -0,0 +1,107 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/juruen/rmapi/annotations"
+	"github.com/juruen/rmapi/api/local"
+	"github.com/juruen/rmapi/filetree"
+	"github.com/juruen/rmapi/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportDaemon(t *testing.T) {
+	apiCtx, err := local.CreateCtx(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	folder, err := apiCtx.CreateDir("", "Books", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = apiCtx.UploadDocument(folder.ID, "../annotations/testfiles/a4.zip", true); err != nil {
+		t.Fatal(err)
+	}
+	if err = apiCtx.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	var printed []string
+	dir := t.TempDir()
+	d := &exportDaemon{
+		ctx:     &ShellCtxt{api: apiCtx, node: apiCtx.Filetree().Root(), path: "/"},
+		printf:  func(format string, a ...interface{}) { printed = append(printed, fmt.Sprintf(format, a...)) },
+		dir:     dir,
+		prefix:  "/",
+		options: annotations.PdfGeneratorOptions{AllPages: true},
+	}
+	assert.NoError(t, d.loadState())
+
+	assert.NoError(t, d.export(false))
+	assert.Equal(t, []string{"exported [Books/a4.pdf]\n"}, printed)
+	assert.FileExists(t, filepath.Join(dir, "Books", "a4.pdf"))
+
+	// the state survives a restart and nothing changed
+	printed = nil
+	assert.NoError(t, d.loadState())
+	assert.NoError(t, d.export(true))
+	assert.Empty(t, printed)
+
+	node, err := apiCtx.Filetree().NodeByPath("/Books/a4", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = apiCtx.MoveEntry(node, apiCtx.Filetree().Root(), "moved"); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, d.export(true))
+	assert.FileExists(t, filepath.Join(dir, "moved.pdf"))
+	_, err = os.Stat(filepath.Join(dir, "Books"))
+	assert.True(t, os.IsNotExist(err))
+
+	node, err = apiCtx.Filetree().NodeByPath("/moved", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, apiCtx.DeleteEntry(node))
+	assert.NoError(t, d.export(true))
+	_, err = os.Stat(filepath.Join(dir, "moved.pdf"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Empty(t, d.state.Documents)
+
+	// a failed export is tried again on the next pass
+	missing := &model.Document{ID: "missing", VissibleName: "missing", Type: model.DocumentType, Version: 1}
+	apiCtx.Filetree().AddDocument(missing)
+	assert.NoError(t, d.exportDoc(apiCtx.Filetree().NodeById("missing"), "key", "missing.pdf"))
+	if assert.Contains(t, d.state.Documents, "missing") {
+		assert.Empty(t, d.state.Documents["missing"].Key)
+		assert.NotEmpty(t, d.state.Documents["missing"].Error)
+	}
+}
+
+func TestExportPath(t *testing.T) {
+	ctx := filetree.CreateFileTreeCtx()
+	ctx.AddDocument(&model.Document{ID: "1", VissibleName: "a/b", Type: model.DirectoryType})
+	ctx.AddDocument(&model.Document{ID: "2", VissibleName: "notes", Type: model.DocumentType, Parent: "1"})
+	ctx.AddDocument(&model.Document{ID: "3", VissibleName: "..", Type: model.DirectoryType})
+	ctx.AddDocument(&model.Document{ID: "4", VissibleName: "secret", Type: model.DocumentType, Parent: "3"})
+
+	rel, err := exportPath(ctx.NodeById("2"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a_b/notes.pdf", rel)
+
+	_, err = exportPath(ctx.NodeById("4"))
+	assert.Error(t, err)
+
+	d := &exportDaemon{dir: t.TempDir()}
+	_, err = d.localPath("../outside.pdf")
+	assert.Error(t, err)
+	_, err = d.localPath("Books/../../outside.pdf")
+	assert.Error(t, err)
+	file, err := d.localPath("Books/notes.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(d.dir, "Books", "notes.pdf"), file)
+}
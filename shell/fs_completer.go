@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/juruen/rmapi/log"
+	"github.com/juruen/rmapi/util"
 )
 
 func prefixToDir(s []string) string {
@@ -110,7 +111,7 @@ func createFsCompleter(check fileCheckFn) func([]string) []string {
 
 			entry = escapeSpaces(entry)
 
-			if !n.IsDir() && !strings.HasSuffix(entry, ".pdf") && !strings.HasSuffix(entry, ".epub") {
+			if _, ext := util.DocPathToName(n.Name()); !n.IsDir() && !util.IsFileTypeSupported(ext) {
 				continue
 			}
 
@@ -10,7 +10,7 @@ import (
 func getCmd(ctx *ShellCtxt) *ishell.Cmd {
 	return &ishell.Cmd{
 		Name:      "get",
-		Help:      "copy remote file to local",
+		Help:      "copy remote files to local, usage: get file... (globs like Inbox/*.pdf are expanded)",
 		Completer: createEntryCompleter(ctx),
 		Func: func(c *ishell.Context) {
 			if len(c.Args) == 0 {
@@ -18,25 +18,29 @@ func getCmd(ctx *ShellCtxt) *ishell.Cmd {
 				return
 			}
 
-			srcName := c.Args[0]
-
-			node, err := ctx.api.Filetree().NodeByPath(srcName, ctx.node)
-
-			if err != nil || node.IsDirectory() {
-				c.Err(errors.New("file doesn't exist"))
+			nodes, err := ctx.resolveTargets(c.Args)
+			if err != nil {
+				c.Err(err)
 				return
 			}
 
-			c.Println(fmt.Sprintf("downloading: [%s]...", srcName))
+			for _, node := range nodes {
+				if node.IsDirectory() {
+					c.Err(fmt.Errorf("%s is a directory", node.Name()))
+					continue
+				}
+
+				c.Println(fmt.Sprintf("downloading: [%s]...", node.Name()))
 
-			err = ctx.api.FetchDocument(node.Document.ID, fmt.Sprintf("%s.zip", node.Name()))
+				err = ctx.api.FetchDocument(node.Document.ID, fmt.Sprintf("%s.zip", node.Name()))
+
+				if err != nil {
+					c.Err(errors.New(fmt.Sprintf("Failed to download file %s with %s", node.Name(), err.Error())))
+					continue
+				}
 
-			if err == nil {
 				c.Println("OK")
-				return
 			}
-
-			c.Err(errors.New(fmt.Sprintf("Failed to download file %s with %s", srcName, err.Error())))
 		},
 	}
 }
@@ -7,19 +7,21 @@ import (
 
 	"github.com/abiosoft/ishell"
 	"github.com/juruen/rmapi/annotations"
+	"github.com/juruen/rmapi/config"
 )
 
 func getACmd(ctx *ShellCtxt) *ishell.Cmd {
 	return &ishell.Cmd{
 		Name:      "geta",
-		Help:      "copy remote file to local and generate a PDF with its annotations",
+		Help:      "copy remote files to local and generate a PDF with their annotations, usage: geta [-p -a -n] file... (globs are expanded)",
 		Completer: createEntryCompleter(ctx),
 		Func: func(c *ishell.Context) {
 
 			flagSet := flag.NewFlagSet("geta", flag.ContinueOnError)
-			addPageNumbers := flagSet.Bool("p", false, "add page numbers")
-			allPages := flagSet.Bool("a", false, "all pages")
-			annotationsOnly := flagSet.Bool("n", false, "annotations only")
+			defaults := config.Active().Export
+			addPageNumbers := flagSet.Bool("p", defaults.PageNumbers, "add page numbers")
+			allPages := flagSet.Bool("a", defaults.AllPages, "all pages")
+			annotationsOnly := flagSet.Bool("n", defaults.AnnotationsOnly, "annotations only")
 			if err := flagSet.Parse(c.Args); err != nil {
 				if err != flag.ErrHelp {
 					c.Err(err)
@@ -32,36 +34,40 @@ func getACmd(ctx *ShellCtxt) *ishell.Cmd {
 				return
 			}
 
-			srcName := argRest[0]
-
-			node, err := ctx.api.Filetree().NodeByPath(srcName, ctx.node)
-
-			if err != nil || node.IsDirectory() {
-				c.Err(errors.New("file doesn't exist"))
+			nodes, err := ctx.resolveTargets(argRest)
+			if err != nil {
+				c.Err(err)
 				return
 			}
 
-			c.Println(fmt.Sprintf("downloading: [%s]...", srcName))
+			options := annotations.PdfGeneratorOptions{AddPageNumbers: *addPageNumbers, AllPages: *allPages, AnnotationsOnly: *annotationsOnly}
+			for _, node := range nodes {
+				if node.IsDirectory() {
+					c.Err(fmt.Errorf("%s is a directory", node.Name()))
+					continue
+				}
 
-			zipName := fmt.Sprintf("%s.zip", node.Name())
-			err = ctx.api.FetchDocument(node.Document.ID, zipName)
+				c.Println(fmt.Sprintf("downloading: [%s]...", node.Name()))
 
-			if err != nil {
-				c.Err(errors.New(fmt.Sprintf("Failed to download file %s with %s", srcName, err.Error())))
-				return
-			}
+				zipName := fmt.Sprintf("%s.zip", node.Name())
+				err = ctx.api.FetchDocument(node.Document.ID, zipName)
 
-			pdfName := fmt.Sprintf("%s-annotations.pdf", node.Name())
-			options := annotations.PdfGeneratorOptions{AddPageNumbers: *addPageNumbers, AllPages: *allPages, AnnotationsOnly: *annotationsOnly}
-			generator := annotations.CreatePdfGenerator(zipName, pdfName, options)
-			err = generator.Generate()
+				if err != nil {
+					c.Err(errors.New(fmt.Sprintf("Failed to download file %s with %s", node.Name(), err.Error())))
+					continue
+				}
 
-			if err != nil {
-				c.Err(errors.New(fmt.Sprintf("Failed to generate annotations for %s with %s", srcName, err.Error())))
-				return
-			}
+				pdfName := fmt.Sprintf("%s-annotations.pdf", node.Name())
+				generator := annotations.CreatePdfGenerator(zipName, pdfName, options)
+				err = generator.Generate()
+
+				if err != nil {
+					c.Err(errors.New(fmt.Sprintf("Failed to generate annotations for %s with %s", node.Name(), err.Error())))
+					continue
+				}
 
-			c.Printf("Annotations generated in: %s\n", pdfName)
+				c.Printf("Annotations generated in: %s\n", pdfName)
+			}
 		},
 	}
 }
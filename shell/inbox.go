@@ -0,0 +1,328 @@
+package shell
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/ishell"
+	"github.com/fsnotify/fsnotify"
+	"github.com/juruen/rmapi/log"
+	"github.com/juruen/rmapi/model"
+	"github.com/juruen/rmapi/util"
+)
+
+const (
+	// inboxStateFile keeps the hashes of the files sent, to skip duplicates
+	inboxStateFile = ".rmapi-inbox.json"
+	// inboxSentDir is the subdirectory the sent files are moved to
+	inboxSentDir = "sent"
+	// inboxMaxBackoff is the longest wait before sending a failed file again
+	inboxMaxBackoff = 10 * time.Minute
+)
+
+// inboxState maps the hash of the content of the files sent to the id of their document
+type inboxState struct {
+	Sent map[string]string `json:"sent"`
+}
+
+// inbox uploads the files dropped in a local directory to a remote directory
+type inbox struct {
+	ctx        *ShellCtxt
+	printf     func(format string, a ...interface{})
+	dir        string
+	remote     *model.Node
+	remove     bool
+	retries    int
+	retryDelay time.Duration
+	state      inboxState
+}
+
+func inboxCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name:      "inbox",
+		Help:      "upload the files dropped in a local directory until interrupted, usage: inbox [--delete] [--retries 3] [--settle 2s] localdir remotedir",
+		Completer: createFsEntryCompleter(),
+		Func: func(c *ishell.Context) {
+			flagSet := flag.NewFlagSet("inbox", flag.ContinueOnError)
+			remove := flagSet.Bool("delete", false, "delete the files sent instead of moving them to "+inboxSentDir+"/")
+			retries := flagSet.Int("retries", 3, "number of retries of a failed upload")
+			settle := flagSet.Duration("settle", 2*time.Second, "time without changes before a file is sent, to let it be fully written")
+
+			args, err := parseFlags(flagSet, c.Args)
+			if err != nil {
+				if err != flag.ErrHelp {
+					c.Err(err)
+				}
+				return
+			}
+
+			if len(args) != 2 {
+				c.Err(errors.New("missing local and/or remote directory"))
+				return
+			}
+			if *settle <= 0 {
+				c.Err(errors.New("the settle time should be positive"))
+				return
+			}
+
+			if fi, err := os.Stat(args[0]); err != nil || !fi.IsDir() {
+				c.Err(errors.New("local directory doesn't exist"))
+				return
+			}
+			remote, err := ctx.api.Filetree().NodeByPath(args[1], ctx.node)
+			if err != nil || remote.IsFile() {
+				c.Err(errors.New("directory doesn't exist"))
+				return
+			}
+
+			in := &inbox{
+				ctx:        ctx,
+				printf:     c.Printf,
+				dir:        args[0],
+				remote:     remote,
+				remove:     *remove,
+				retries:    *retries,
+				retryDelay: 2 * time.Second,
+			}
+			if err = in.loadState(); err != nil {
+				c.Err(err)
+				return
+			}
+			if err = in.watch(*settle); err != nil {
+				c.Err(err)
+			}
+		},
+	}
+}
+
+// watch sends the files already in the directory and then the new ones once
+// they haven't changed for settle, until interrupted
+func (in *inbox) watch(settle time.Duration) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err = watcher.Add(in.dir); err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(in.dir)
+	if err != nil {
+		return err
+	}
+	// the last change of the files not sent yet, the failed files are put back
+	// with a later time so they're sent again after a backoff
+	pending := make(map[string]time.Time)
+	failures := make(map[string]int)
+	send := func(file string, now time.Time) {
+		if in.send(file) {
+			delete(failures, file)
+			return
+		}
+		failures[file]++
+		pending[file] = now.Add(in.backoff(failures[file]))
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, e := range entries {
+		send(filepath.Join(in.dir, e.Name()), time.Now())
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(settle / 2)
+	defer ticker.Stop()
+
+	in.printf("waiting for files in [%s]...\n", in.dir)
+
+	for {
+		select {
+		case <-interrupt:
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write) != 0 {
+				pending[event.Name] = time.Now()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Warning.Println("watching the inbox failed:", err)
+		case now := <-ticker.C:
+			ready := make([]string, 0)
+			for file, changed := range pending {
+				if now.Sub(changed) >= settle {
+					ready = append(ready, file)
+					delete(pending, file)
+				}
+			}
+			sort.Strings(ready)
+			for _, file := range ready {
+				send(file, now)
+			}
+		}
+	}
+}
+
+// send uploads a file of the inbox and prints why it failed, the file is left
+// in place to be sent again. It returns false when it failed.
+func (in *inbox) send(file string) bool {
+	if err := in.process(file); err != nil {
+		in.printf("failed to send [%s]: %v\n", filepath.Base(file), err)
+		return false
+	}
+	return true
+}
+
+// backoff is the wait before sending a file again after its nth failure
+func (in *inbox) backoff(failures int) time.Duration {
+	delay := in.retryDelay
+	for i := 0; i < failures && delay < inboxMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > inboxMaxBackoff {
+		return inboxMaxBackoff
+	}
+	return delay
+}
+
+// process uploads a file unless it's a duplicate and then moves it to sent/ or deletes it.
+// Hidden, unsupported and vanished files are ignored.
+func (in *inbox) process(file string) error {
+	name := filepath.Base(file)
+	fi, err := os.Stat(file)
+	if err != nil || !fi.Mode().IsRegular() || strings.HasPrefix(name, ".") {
+		return nil
+	}
+
+	docName, ext := util.DocPathToName(name)
+	if !util.IsFileTypeSupported(ext) {
+		in.printf("skipping unsupported file [%s]\n", name)
+		return nil
+	}
+
+	hash, err := fileHash(file)
+	if err != nil {
+		return err
+	}
+	if id, ok := in.state.Sent[hash]; ok && in.ctx.api.Filetree().NodeById(id) != nil {
+		in.printf("[%s] was already sent, skipping\n", name)
+		return in.done(file)
+	}
+
+	src := file
+	if _, err = in.ctx.api.Filetree().NodeByPath(docName, in.remote); err == nil {
+		copyName, cleanup, err := uploadAs(in.ctx, file, in.remote)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		src = copyName
+	}
+
+	var document *model.Document
+	for attempt := 0; ; attempt++ {
+		in.printf("uploading: [%s]...", name)
+		document, err = in.ctx.api.UploadDocument(in.remote.Id(), src, true)
+		if err == nil {
+			break
+		}
+		in.printf("failed: %v\n", err)
+		if attempt == in.retries {
+			return err
+		}
+		time.Sleep(in.retryDelay << attempt)
+	}
+	in.printf("OK\n")
+	in.ctx.api.Filetree().AddDocument(document)
+
+	in.state.Sent[hash] = document.ID
+	if err = in.saveState(); err != nil {
+		return err
+	}
+	return in.done(file)
+}
+
+// done deletes a sent file or moves it to sent/ with a free name
+func (in *inbox) done(file string) error {
+	if in.remove {
+		return os.Remove(file)
+	}
+
+	sentDir := filepath.Join(in.dir, inboxSentDir)
+	if err := os.MkdirAll(sentDir, 0755); err != nil {
+		return err
+	}
+
+	name := filepath.Base(file)
+	ext := filepath.Ext(name)
+	dst := filepath.Join(sentDir, name)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(dst); os.IsNotExist(err) {
+			break
+		}
+		dst = filepath.Join(sentDir, fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext))
+	}
+
+	return os.Rename(file, dst)
+}
+
+func fileHash(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err = io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func (in *inbox) loadState() error {
+	in.state = inboxState{Sent: make(map[string]string)}
+
+	content, err := ioutil.ReadFile(filepath.Join(in.dir, inboxStateFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(content, &in.state); err != nil {
+		return fmt.Errorf("corrupt state file %s: %v", inboxStateFile, err)
+	}
+	if in.state.Sent == nil {
+		in.state.Sent = make(map[string]string)
+	}
+	return nil
+}
+
+func (in *inbox) saveState() error {
+	content, err := json.MarshalIndent(in.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(filepath.Join(in.dir, inboxStateFile), content, 0644)
+}
@@ -0,0 +1,68 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/juruen/rmapi/api/local"
+	"github.com/juruen/rmapi/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInbox(t *testing.T) {
+	apiCtx, err := local.CreateCtx(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	folder, err := apiCtx.CreateDir("", "Scans", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiCtx.Filetree().AddDocument(folder)
+
+	dir := t.TempDir()
+	in := &inbox{
+		ctx:    &ShellCtxt{api: apiCtx, node: apiCtx.Filetree().Root(), path: "/"},
+		printf: func(string, ...interface{}) {},
+		dir:    dir,
+		remote: apiCtx.Filetree().NodeById(folder.ID),
+	}
+	assert.NoError(t, in.loadState())
+
+	scan := filepath.Join(dir, "scan.pdf")
+	if _, err = util.CopyFile("../archive/zipdoc_test.pdf", scan); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, in.process(scan))
+	assert.FileExists(t, filepath.Join(dir, inboxSentDir, "scan.pdf"))
+	_, err = apiCtx.Filetree().NodeByPath("/Scans/scan", nil)
+	assert.NoError(t, err)
+
+	// the same content is only sent once
+	if _, err = util.CopyFile("../archive/zipdoc_test.pdf", scan); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, in.loadState())
+	assert.NoError(t, in.process(scan))
+	assert.FileExists(t, filepath.Join(dir, inboxSentDir, "scan (1).pdf"))
+	assert.Len(t, in.remote.Children, 1)
+
+	// unsupported files stay
+	other := filepath.Join(dir, "notes.xyz")
+	if err = os.WriteFile(other, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, in.process(other))
+	assert.FileExists(t, other)
+
+	// the state is replaced in one step
+	tmpFiles, _ := filepath.Glob(filepath.Join(dir, ".*.tmp"))
+	assert.Empty(t, tmpFiles)
+
+	in.retryDelay = time.Second
+	assert.Equal(t, 2*time.Second, in.backoff(1))
+	assert.Equal(t, 8*time.Second, in.backoff(3))
+	assert.Equal(t, inboxMaxBackoff, in.backoff(20))
+}
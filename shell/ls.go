@@ -1,39 +1,256 @@
 package shell
 
 import (
-	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"time"
 
 	"github.com/abiosoft/ishell"
+	"github.com/juruen/rmapi/api"
+	"github.com/juruen/rmapi/filetree"
+	"github.com/juruen/rmapi/log"
+	"github.com/juruen/rmapi/model"
 )
 
+// lsOptions are the flags of ls, which can be combined like -lt
+type lsOptions struct {
+	long      bool
+	byTime    bool
+	bySize    bool
+	reverse   bool
+	recursive bool
+}
+
 func lsCmd(ctx *ShellCtxt) *ishell.Cmd {
 	return &ishell.Cmd{
 		Name:      "ls",
-		Help:      "list directory",
+		Help:      "list directory, usage: ls [-l] [-t|-S] [-r] [-R] [entry...] (globs like Books/* are expanded)",
 		Completer: createEntryCompleter(ctx),
 		Func: func(c *ishell.Context) {
-			node := ctx.node
-
-			if len(c.Args) == 1 {
-				target := c.Args[0]
-
-				argNode, err := ctx.api.Filetree().NodeByPath(target, ctx.node)
+			options, args, err := parseLsFlags(c.Args)
+			if err != nil {
+				c.Err(err)
+				return
+			}
 
-				if err != nil || node.IsFile() {
-					c.Err(errors.New("directory doesn't exist"))
+			targets := []*model.Node{ctx.node}
+			if len(args) > 0 {
+				if targets, err = ctx.resolveTargets(args); err != nil {
+					c.Err(err)
 					return
 				}
+			}
 
-				node = argNode
+			// the files given are listed first, then the directories
+			files := make([]*model.Node, 0)
+			dirs := make([]*model.Node, 0)
+			for _, node := range targets {
+				if node.IsFile() {
+					files = append(files, node)
+				} else {
+					dirs = append(dirs, node)
+				}
 			}
+			if options.long {
+				ctx.loadContentInfo(files, dirs, options.recursive)
+			}
+			sortNodes(files, options)
+			printEntries(c, files, options)
 
-			for _, e := range node.Children {
-				eType := "d"
-				if e.IsFile() {
-					eType = "f"
+			withHeaders := len(targets) > 1 || options.recursive
+			for i, node := range dirs {
+				if i > 0 || len(files) > 0 {
+					c.Println()
+				}
+				dirPath, err := ctx.api.Filetree().NodeToPath(node)
+				if err != nil {
+					dirPath = node.Name()
 				}
-				c.Printf("[%s]\t%s\n", eType, e.Name())
+				listDir(c, node, dirPath, options, withHeaders)
 			}
 		},
 	}
 }
+
+// parseLsFlags separates the flags of ls from the entries, -- ends the flags
+func parseLsFlags(args []string) (lsOptions, []string, error) {
+	var options lsOptions
+	entries := make([]string, 0, len(args))
+
+	for i, arg := range args {
+		if arg == "--" {
+			entries = append(entries, args[i+1:]...)
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			entries = append(entries, arg)
+			continue
+		}
+
+		for _, f := range arg[1:] {
+			switch f {
+			case 'l':
+				options.long = true
+			case 't':
+				options.byTime = true
+			case 'S':
+				options.bySize = true
+			case 'r':
+				options.reverse = true
+			case 'R':
+				options.recursive = true
+			default:
+				return options, nil, fmt.Errorf("unknown flag -%c, usage: ls [-l] [-t|-S] [-r] [-R] [entry...]", f)
+			}
+		}
+	}
+
+	return options, entries, nil
+}
+
+// loadContentInfo reads the type and pages shown by -l of the files and of the entries of dirs,
+// when the backend only reads them on demand
+func (ctx *ShellCtxt) loadContentInfo(files, dirs []*model.Node, recursive bool) {
+	loader, ok := ctx.api.(api.ContentInfoCtx)
+	if !ok {
+		return
+	}
+
+	nodes := append([]*model.Node{}, files...)
+	var walk func(dir *model.Node)
+	walk = func(dir *model.Node) {
+		for _, e := range dir.Children {
+			nodes = append(nodes, e)
+			if recursive && e.IsDirectory() {
+				walk(e)
+			}
+		}
+	}
+	for _, dir := range dirs {
+		walk(dir)
+	}
+
+	if err := loader.LoadContentInfo(nodes); err != nil {
+		log.Warning.Printf("cannot save the type and pages of the documents: %v", err)
+	}
+}
+
+// listDir prints the entries of a directory, and with -R the ones of its subdirectories
+func listDir(c *ishell.Context, dir *model.Node, dirPath string, options lsOptions, withHeader bool) {
+	if withHeader {
+		c.Printf("%s:\n", dirPath)
+	}
+
+	entries := make([]*model.Node, 0, len(dir.Children))
+	for _, e := range dir.Children {
+		entries = append(entries, e)
+	}
+	sortNodes(entries, options)
+	printEntries(c, entries, options)
+
+	if !options.recursive {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDirectory() {
+			c.Println()
+			listDir(c, e, path.Join(dirPath, filetree.EntryName(e)), options, true)
+		}
+	}
+}
+
+// sortNodes sorts entries by name, or the latest or largest first
+func sortNodes(nodes []*model.Node, options lsOptions) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return filetree.EntryName(nodes[i]) < filetree.EntryName(nodes[j])
+	})
+
+	switch {
+	case options.bySize:
+		sort.SliceStable(nodes, func(i, j int) bool { return nodeSize(nodes[i]) > nodeSize(nodes[j]) })
+	case options.byTime:
+		sort.SliceStable(nodes, func(i, j int) bool { return modifiedTime(nodes[i]).After(modifiedTime(nodes[j])) })
+	}
+
+	if options.reverse {
+		for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+			nodes[i], nodes[j] = nodes[j], nodes[i]
+		}
+	}
+}
+
+// printEntries prints an entry per line, with -l its type, pages, size, last modification and
+// a * when it's pinned. Unknown values are printed as -.
+func printEntries(c *ishell.Context, nodes []*model.Node, options lsOptions) {
+	for _, e := range nodes {
+		eType := "d"
+		if e.IsFile() {
+			eType = "f"
+		}
+
+		name := filetree.EntryName(e)
+		if name != e.Name() {
+			name += fmt.Sprintf("\t(duplicate name, %s%s)", filetree.IdPrefix, e.Id())
+		}
+		if !options.long {
+			c.Printf("[%s]\t%s\n", eType, name)
+			continue
+		}
+
+		kind, pages, size, modified, pinned := "-", "-", "-", "-", " "
+		if e.IsFile() && e.Document.FileType != "" {
+			kind = e.Document.FileType
+		} else if e.IsFile() && e.Document.PageCount > 0 {
+			kind = "notebook"
+		}
+		if e.Document.PageCount > 0 {
+			pages = strconv.Itoa(e.Document.PageCount)
+		}
+		if s := nodeSize(e); s > 0 {
+			size = formatSize(s)
+		}
+		if t := modifiedTime(e); !t.IsZero() {
+			modified = t.Local().Format("2006-01-02 15:04")
+		}
+		if e.Document.Bookmarked {
+			pinned = "*"
+		}
+		c.Printf("[%s] %-8s %5s %9s %16s %s %s\n", eType, kind, pages, size, modified, pinned, name)
+	}
+}
+
+// nodeSize is the size of a document, or of all the documents under a directory
+func nodeSize(node *model.Node) int64 {
+	size := node.Document.Size
+	for _, c := range node.Children {
+		size += nodeSize(c)
+	}
+	return size
+}
+
+// modifiedTime is the last modification of an entry, zero when unknown
+func modifiedTime(node *model.Node) time.Time {
+	t, err := node.LastModified()
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// formatSize prints a size in bytes with a unit of powers of 1000
+func formatSize(size int64) string {
+	if size < 1000 {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value := float64(size)
+	for _, unit := range []string{"kB", "MB", "GB"} {
+		value /= 1000
+		if value < 1000 {
+			return fmt.Sprintf("%.1f %s", value, unit)
+		}
+	}
+	return fmt.Sprintf("%.1f TB", value/1000)
+}
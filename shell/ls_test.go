@@ -0,0 +1,53 @@
+package shell
+
+import (
+	"testing"
+
+	"github.com/juruen/rmapi/filetree"
+	"github.com/juruen/rmapi/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLsFlags(t *testing.T) {
+	options, entries, err := parseLsFlags([]string{"-lt", "Books", "-r", "--", "-notes"})
+	assert.NoError(t, err)
+	assert.Equal(t, lsOptions{long: true, byTime: true, reverse: true}, options)
+	assert.Equal(t, []string{"Books", "-notes"}, entries)
+
+	_, _, err = parseLsFlags([]string{"-x"})
+	assert.Error(t, err)
+}
+
+func TestSortNodes(t *testing.T) {
+	ctx := filetree.CreateFileTreeCtx()
+	ctx.AddDocument(&model.Document{ID: "1", VissibleName: "b", Type: model.DocumentType, Size: 10, ModifiedClient: "2023-01-02T00:00:00Z"})
+	ctx.AddDocument(&model.Document{ID: "2", VissibleName: "a", Type: model.DocumentType, Size: 5, ModifiedClient: "2023-01-03T00:00:00Z"})
+	ctx.AddDocument(&model.Document{ID: "3", VissibleName: "c", Type: model.DirectoryType})
+	ctx.AddDocument(&model.Document{ID: "4", VissibleName: "d", Type: model.DocumentType, Parent: "3", Size: 20})
+
+	names := func(options lsOptions) []string {
+		nodes := make([]*model.Node, 0)
+		for _, n := range ctx.Root().Children {
+			nodes = append(nodes, n)
+		}
+		sortNodes(nodes, options)
+		result := make([]string, 0, len(nodes))
+		for _, n := range nodes {
+			result = append(result, n.Name())
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"a", "b", "c"}, names(lsOptions{}))
+	assert.Equal(t, []string{"c", "b", "a"}, names(lsOptions{reverse: true}))
+	assert.Equal(t, []string{"c", "b", "a"}, names(lsOptions{bySize: true}))
+	assert.Equal(t, []string{"a", "b", "c"}, names(lsOptions{byTime: true}))
+	assert.Equal(t, int64(35), nodeSize(ctx.Root()))
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "999 B", formatSize(999))
+	assert.Equal(t, "1.5 kB", formatSize(1500))
+	assert.Equal(t, "2.0 MB", formatSize(2000000))
+	assert.Equal(t, "3.0 GB", formatSize(3000000000))
+}
@@ -0,0 +1,119 @@
+package shell
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/abiosoft/ishell"
+	"github.com/juruen/rmapi/archive"
+	"github.com/juruen/rmapi/encoding/rm"
+)
+
+func mknoteCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name:      "mknote",
+		Help:      "create a notebook, usage: mknote name [--pages N] [--template Blank|Lined|Grid|Dots|Checklist|<name>] [--rm page.rm]",
+		Completer: createDirCompleter(ctx),
+		Func: func(c *ishell.Context) {
+			flagSet := flag.NewFlagSet("mknote", flag.ContinueOnError)
+			pages := flagSet.Int("pages", 1, "number of pages")
+			template := flagSet.String("template", "Blank", "background template")
+			rmFile := flagSet.String("rm", "", "local .rm page copied into every page")
+
+			args, err := parseFlags(flagSet, c.Args)
+			if err != nil {
+				if err != flag.ErrHelp {
+					c.Err(err)
+				}
+				return
+			}
+
+			if len(args) == 0 {
+				c.Err(errors.New("missing notebook name"))
+				return
+			}
+
+			if *pages < 1 {
+				c.Err(errors.New("a notebook needs at least one page"))
+				return
+			}
+
+			target := args[0]
+
+			if _, err := ctx.api.Filetree().NodeByPath(target, ctx.node); err == nil {
+				c.Err(errors.New("entry already exists"))
+				return
+			}
+
+			parentDir := path.Dir(target)
+			name := path.Base(target)
+
+			if name == "/" || name == "." {
+				c.Err(errors.New("invalid notebook name"))
+				return
+			}
+
+			parentNode, err := ctx.api.Filetree().NodeByPath(parentDir, ctx.node)
+
+			if err != nil || parentNode.IsFile() {
+				c.Err(errors.New("directory doesn't exist"))
+				return
+			}
+
+			var page *rm.Rm
+			if *rmFile != "" {
+				data, err := os.ReadFile(*rmFile)
+				if err != nil {
+					c.Err(err)
+					return
+				}
+				page = rm.New()
+				if err = page.UnmarshalBinary(data); err != nil {
+					c.Err(fmt.Errorf("can't read %s: %v", *rmFile, err))
+					return
+				}
+			}
+
+			tmpDir, err := os.MkdirTemp("", "rmnote")
+			if err != nil {
+				c.Err(err)
+				return
+			}
+			defer os.RemoveAll(tmpDir)
+
+			// the document name is taken from the file name
+			zipPath := filepath.Join(tmpDir, name+".zip")
+			zipFile, err := os.Create(zipPath)
+			if err != nil {
+				c.Err(err)
+				return
+			}
+
+			notebook := archive.NewNotebook(*pages, *template, page)
+			err = notebook.Write(zipFile)
+			zipFile.Close()
+			if err != nil {
+				c.Err(err)
+				return
+			}
+
+			parentId := parentNode.Id()
+			if parentNode.IsRoot() {
+				parentId = ""
+			}
+
+			document, err := ctx.api.UploadDocument(parentId, zipPath, true)
+
+			if err != nil {
+				c.Err(fmt.Errorf("failed to create notebook %v", err))
+				return
+			}
+
+			ctx.api.Filetree().AddDocument(document)
+		},
+	}
+}
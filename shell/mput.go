@@ -187,6 +187,8 @@ func putFilesAndDirs(pCtx *ShellCtxt, pC *ishell.Context, localDir string, depth
 			docName, ext := util.DocPathToName(name)
 
 			if !util.IsFileTypeSupported(ext) {
+				treeFormat(pC, depth, index, lSize, tFS)
+				pC.Printf("skipping unsupported file [%s]\n", name)
 				continue
 			}
 
@@ -11,7 +11,7 @@ import (
 func mvCmd(ctx *ShellCtxt) *ishell.Cmd {
 	return &ishell.Cmd{
 		Name:      "mv",
-		Help:      "mv file or directory",
+		Help:      "mv file or directory, usage: mv src... dst (globs like Inbox/*.pdf are expanded)",
 		Completer: createEntryCompleter(ctx),
 		Func: func(c *ishell.Context) {
 			if len(c.Args) < 2 {
@@ -19,16 +19,14 @@ func mvCmd(ctx *ShellCtxt) *ishell.Cmd {
 				return
 			}
 
-			src := c.Args[0]
-
-			srcNode, err := ctx.api.Filetree().NodeByPath(src, ctx.node)
+			srcNodes, err := ctx.resolveTargets(c.Args[:len(c.Args)-1])
 
 			if err != nil {
-				c.Err(errors.New("source entry doesn't exist"))
+				c.Err(err)
 				return
 			}
 
-			dst := c.Args[1]
+			dst := c.Args[len(c.Args)-1]
 
 			dstNode, err := ctx.api.Filetree().NodeByPath(dst, ctx.node)
 
@@ -37,18 +35,26 @@ func mvCmd(ctx *ShellCtxt) *ishell.Cmd {
 				return
 			}
 
-			// We are moving the node to antoher directory
+			// We are moving the nodes to antoher directory
 			if dstNode != nil && dstNode.IsDirectory() {
-				n, err := ctx.api.MoveEntry(srcNode, dstNode, srcNode.Name())
+				for _, srcNode := range srcNodes {
+					n, err := ctx.api.MoveEntry(srcNode, dstNode, srcNode.Name())
+
+					if err != nil {
+						c.Err(errors.New(fmt.Sprint("failed to move entry", err)))
+						return
+					}
 
-				if err != nil {
-					c.Err(errors.New(fmt.Sprint("failed to move entry", err)))
-					return
+					ctx.api.Filetree().MoveNode(srcNode, n)
 				}
+				return
+			}
 
-				ctx.api.Filetree().MoveNode(srcNode, n)
+			if len(srcNodes) > 1 {
+				c.Err(errors.New("destination directory doesn't exist"))
 				return
 			}
+			srcNode := srcNodes[0]
 
 			// We are renaming the node
 			parentDir := path.Dir(dst)
@@ -2,32 +2,55 @@ package shell
 
 import (
 	"errors"
+	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/abiosoft/ishell"
+	"github.com/juruen/rmapi/annotations"
+	"github.com/juruen/rmapi/archive"
+	"github.com/juruen/rmapi/convert"
+	"github.com/juruen/rmapi/model"
 	"github.com/juruen/rmapi/util"
 )
 
 func putCmd(ctx *ShellCtxt) *ishell.Cmd {
 	return &ishell.Cmd{
 		Name:      "put",
-		Help:      "copy a local document to cloud",
+		Help:      "copy a local document to cloud, usage: put [--force|--replace] file [dir]",
 		Completer: createFsEntryCompleter(),
 		Func: func(c *ishell.Context) {
-			if len(c.Args) == 0 {
+			flagSet := flag.NewFlagSet("put", flag.ContinueOnError)
+			force := flagSet.Bool("force", false, "upload a copy with a suffixed name if the document exists")
+			replace := flagSet.Bool("replace", false, "replace the contents of the existing document keeping its annotations")
+
+			args, err := parseFlags(flagSet, c.Args)
+			if err != nil {
+				if err != flag.ErrHelp {
+					c.Err(err)
+				}
+				return
+			}
+
+			if len(args) == 0 {
 				c.Err(errors.New("missing source file"))
 				return
 			}
 
-			srcName := c.Args[0]
+			if *force && *replace {
+				c.Err(errors.New("--force and --replace can't be used together"))
+				return
+			}
+
+			srcName := args[0]
 
 			docName, _ := util.DocPathToName(srcName)
 
 			node := ctx.node
-			var err error
 
-			if len(c.Args) == 2 {
-				node, err = ctx.api.Filetree().NodeByPath(c.Args[1], ctx.node)
+			if len(args) == 2 {
+				node, err = ctx.api.Filetree().NodeByPath(args[1], ctx.node)
 
 				if err != nil || node.IsFile() {
 					c.Err(errors.New("directory doesn't exist"))
@@ -35,11 +58,34 @@ func putCmd(ctx *ShellCtxt) *ishell.Cmd {
 				}
 			}
 
-			_, err = ctx.api.Filetree().NodeByPath(docName, node)
-			//TODO: force flag and overwrite
+			existing, err := ctx.api.Filetree().NodeByPath(docName, node)
 			if err == nil {
-				c.Err(errors.New("entry already exists"))
-				return
+				switch {
+				case *replace && existing.IsFile():
+					c.Printf("replacing: [%s]...", srcName)
+
+					document, err := replaceDocument(ctx, existing, srcName)
+					if err != nil {
+						c.Err(fmt.Errorf("Failed to replace file [%s] %v", srcName, err))
+						return
+					}
+
+					c.Println("OK")
+
+					ctx.api.Filetree().AddDocument(document)
+					return
+				case *force:
+					copyName, cleanup, err := uploadAs(ctx, srcName, node)
+					if err != nil {
+						c.Err(err)
+						return
+					}
+					defer cleanup()
+					srcName = copyName
+				default:
+					c.Err(errors.New("entry already exists, use --force to upload a copy or --replace to overwrite it"))
+					return
+				}
 			}
 
 			c.Printf("uploading: [%s]...", srcName)
@@ -59,3 +105,78 @@ func putCmd(ctx *ShellCtxt) *ishell.Cmd {
 		},
 	}
 }
+
+// freeName returns the first name of the form "name (N)" not used in dir
+func freeName(ctx *ShellCtxt, name string, dir *model.Node) string {
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)", name, i)
+		if _, err := ctx.api.Filetree().NodeByPath(candidate, dir); err != nil {
+			return candidate
+		}
+	}
+}
+
+// uploadAs copies src into a temporary directory with the first free name of dir,
+// since the document name is taken from the file name. cleanup removes the copy.
+func uploadAs(ctx *ShellCtxt, src string, dir *model.Node) (string, func(), error) {
+	docName, ext := util.DocPathToName(src)
+	tmpDir, err := os.MkdirTemp("", "rmput")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmpDir) }
+
+	copyName := filepath.Join(tmpDir, freeName(ctx, docName, dir)+"."+ext)
+	if _, err = util.CopyFile(src, copyName); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return copyName, cleanup, nil
+}
+
+// replaceDocument swaps the payload of an existing document with srcName.
+// The document keeps its id, annotations, tags and last opened page. The pages of a pdf
+// keep the annotations of the page with the same number, see the update command
+// to match them by content.
+func replaceDocument(ctx *ShellCtxt, node *model.Node, srcName string) (*model.Document, error) {
+	tmpDir, err := os.MkdirTemp("", "rmput")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	docPath, ext, err := convert.Prepare(srcName, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	zipPath := filepath.Join(tmpDir, "current.zip")
+	if err = ctx.api.FetchDocument(node.Document.ID, zipPath); err != nil {
+		return nil, err
+	}
+
+	var matches []int
+	if ext == util.PDF {
+		f, err := os.Open(docPath)
+		if err != nil {
+			return nil, err
+		}
+		pageCount, err := annotations.PageCount(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		matches = make([]int, pageCount)
+		for i := range matches {
+			matches[i] = i
+		}
+	}
+
+	updatedPath := filepath.Join(tmpDir, "updated.zip")
+	if err = archive.UpdatePayload(zipPath, docPath, matches, updatedPath); err != nil {
+		return nil, err
+	}
+
+	return ctx.api.ReplaceDocument(node.Document.ID, updatedPath, true)
+}
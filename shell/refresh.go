@@ -16,16 +16,23 @@ func refreshCmd(ctx *ShellCtxt) *ishell.Cmd {
 				c.Err(err)
 				return
 			}
-			n, err := ctx.api.Filetree().NodeByPath(ctx.path, nil)
-			if err != nil {
-				c.Err(errors.New("current path is invalid"))
-
-				ctx.node = ctx.api.Filetree().Root()
-				ctx.path = ctx.node.Name()
+			if err = ctx.reloadNode(); err != nil {
+				c.Err(err)
 				c.SetPrompt(ctx.prompt())
-				return
 			}
-			ctx.node = n
 		},
 	}
 }
+
+// reloadNode finds the current directory in the refreshed tree,
+// going back to the root when it's gone
+func (ctx *ShellCtxt) reloadNode() error {
+	n, err := ctx.api.Filetree().NodeByPath(ctx.path, nil)
+	if err != nil {
+		ctx.node = ctx.api.Filetree().Root()
+		ctx.path = ctx.node.Name()
+		return errors.New("current path is invalid")
+	}
+	ctx.node = n
+	return nil
+}
@@ -10,17 +10,21 @@ import (
 func rmCmd(ctx *ShellCtxt) *ishell.Cmd {
 	return &ishell.Cmd{
 		Name:      "rm",
-		Help:      "delete entry",
+		Help:      "delete entries, usage: rm entry... (globs like Inbox/*.pdf are expanded)",
 		Completer: createEntryCompleter(ctx),
 		Func: func(c *ishell.Context) {
-			for _, target := range c.Args {
-				node, err := ctx.api.Filetree().NodeByPath(target, ctx.node)
+			if len(c.Args) == 0 {
+				c.Err(errors.New("missing entry"))
+				return
+			}
 
-				if err != nil {
-					c.Err(errors.New("entry doesn't exist"))
-					return
-				}
+			nodes, err := ctx.resolveTargets(c.Args)
+			if err != nil {
+				c.Err(err)
+				return
+			}
 
+			for _, node := range nodes {
 				err = ctx.api.DeleteEntry(node)
 
 				if err != nil {
@@ -5,6 +5,7 @@ import (
 	"path"
 	"strings"
 
+	"github.com/juruen/rmapi/filetree"
 	"github.com/juruen/rmapi/log"
 	"github.com/juruen/rmapi/model"
 )
@@ -88,11 +89,12 @@ func createCompleter(ctx *ShellCtxt, check nodeCheckFn) func([]string) []string
 				continue
 			}
 
+			// duplicate names are completed with their index
 			var entry string
 			if n.IsDirectory() {
-				entry = fmt.Sprintf("%s/", n.Name())
+				entry = fmt.Sprintf("%s/", filetree.EntryName(n))
 			} else {
-				entry = fmt.Sprintf("%s", n.Name())
+				entry = fmt.Sprintf("%s", filetree.EntryName(n))
 			}
 
 			if dir != "" {
@@ -0,0 +1,160 @@
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/abiosoft/ishell"
+	shlex "github.com/flynn-archive/go-shlex"
+	"github.com/juruen/rmapi/api"
+)
+
+var (
+	assignmentPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+	variablePattern   = regexp.MustCompile(`\$\$|\$\{[A-Za-z_][A-Za-z0-9_]*\}|\$[A-Za-z_][A-Za-z0-9_]*`)
+)
+
+// script is the state of the commands run from a file, shared with the scripts it sources
+type script struct {
+	vars map[string]string
+	// exitOnError stops at the first command that fails, like set -e
+	exitOnError bool
+	failures    int
+}
+
+func sourceCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name:      "source",
+		Help:      "run the commands of a script file, usage: source file",
+		Completer: createFsEntryCompleter(),
+		Func: func(c *ishell.Context) {
+			if len(c.Args) != 1 {
+				c.Err(errors.New("missing script file"))
+				return
+			}
+
+			if err := ctx.runScript(c.Args[0]); err != nil {
+				c.Err(err)
+			}
+		},
+	}
+}
+
+// runScript runs the commands of a file, - for the standard input, and notifies the tablets
+// once at the end. A script sourced from another one shares its variables and options.
+func (ctx *ShellCtxt) runScript(file string) error {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	batch, isBatch := ctx.api.(api.BatchCtx)
+	if isBatch {
+		batch.BeginBatch()
+	}
+
+	outermost := ctx.script == nil
+	if outermost {
+		ctx.script = &script{vars: make(map[string]string)}
+	}
+	err := ctx.script.run(ctx.shell, file, r)
+	if outermost {
+		if err == nil && ctx.script.failures > 0 {
+			err = fmt.Errorf("%d commands failed", ctx.script.failures)
+		}
+		ctx.script = nil
+	}
+
+	if isBatch {
+		if batchErr := batch.EndBatch(); err == nil {
+			err = batchErr
+		}
+	}
+	return err
+}
+
+// run runs the lines of a script, a backslash at the end of a line continues it on the next one.
+// The failures are printed and counted, unless exitOnError stops the script.
+func (s *script) run(shell *ishell.Shell, name string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	line := ""
+	for scanner.Scan() {
+		lineNumber++
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasSuffix(text, "\\") {
+			line += strings.TrimSuffix(text, "\\") + " "
+			continue
+		}
+		line += text
+
+		err := s.runLine(shell, line)
+		line = ""
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("%s:%d: %v", name, lineNumber, err)
+		if s.exitOnError {
+			return err
+		}
+		shell.Println("Error:", err)
+		s.failures++
+	}
+	return scanner.Err()
+}
+
+// runLine runs a command, sets a variable with NAME=value or an option with set -e and set +e.
+// Comments start with #.
+func (s *script) runLine(shell *ishell.Shell, line string) error {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	args, err := shlex.Split(line)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	if args[0] == "set" && len(args) == 2 && (args[1] == "-e" || args[1] == "+e") {
+		s.exitOnError = args[1] == "-e"
+		return nil
+	}
+	if len(args) == 1 && assignmentPattern.MatchString(args[0]) {
+		i := strings.Index(args[0], "=")
+		s.vars[args[0][:i]] = s.expand(args[0][i+1:])
+		return nil
+	}
+
+	for i := range args {
+		args[i] = s.expand(args[i])
+	}
+	return shell.Process(args...)
+}
+
+// expand replaces $NAME and ${NAME} with the variable of the script or of the environment,
+// $$ is a $
+func (s *script) expand(arg string) string {
+	return variablePattern.ReplaceAllStringFunc(arg, func(v string) string {
+		if v == "$$" {
+			return "$"
+		}
+		name := strings.Trim(v, "${}")
+		if value, ok := s.vars[name]; ok {
+			return value
+		}
+		return os.Getenv(name)
+	})
+}
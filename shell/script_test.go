@@ -0,0 +1,59 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/juruen/rmapi/api"
+	"github.com/juruen/rmapi/api/local"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunScript(t *testing.T) {
+	apiCtx, err := local.CreateCtx(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ctx := newShell(apiCtx, &api.UserInfo{})
+
+	dir := t.TempDir()
+	writeScript := func(name, content string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	included := writeScript("included.rm", "mkdir \"${DIR}/Sub dir\"\n")
+	main := writeScript("main.rm", `# folders of the test
+DIR=Books
+mkdir $DIR
+source `+included+`
+mkdir \
+  $DIR/Other
+rm Missing
+mkdir Last
+`)
+	assert.EqualError(t, ctx.runScript(main), "1 commands failed")
+	for _, p := range []string{"/Books/Sub dir", "/Books/Other", "/Last"} {
+		_, err = apiCtx.Filetree().NodeByPath(p, nil)
+		assert.NoError(t, err, p)
+	}
+	assert.Nil(t, ctx.script)
+
+	stop := writeScript("stop.rm", "set -e\nrm Missing\nmkdir Never\n")
+	assert.Error(t, ctx.runScript(stop))
+	_, err = apiCtx.Filetree().NodeByPath("/Never", nil)
+	assert.Error(t, err)
+}
+
+func TestExpand(t *testing.T) {
+	t.Setenv("RMAPI_TEST_VAR", "env")
+	s := &script{vars: map[string]string{"A": "a", "AB": "ab"}}
+
+	assert.Equal(t, "a/ab/a_x", s.expand("$A/$AB/${A}_x"))
+	assert.Equal(t, "env $A", s.expand("$RMAPI_TEST_VAR $$A"))
+	assert.Equal(t, "-", s.expand("-$UNSET_RMAPI_VAR"))
+}
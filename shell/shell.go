@@ -2,10 +2,10 @@ package shell
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/abiosoft/ishell"
 	"github.com/juruen/rmapi/api"
+	"github.com/juruen/rmapi/config"
 	"github.com/juruen/rmapi/model"
 )
 
@@ -15,6 +15,11 @@ type ShellCtxt struct {
 	path           string
 	useHiddenFiles bool
 	UserInfo       api.UserInfo
+	// accounts are the other accounts opened by xcp, by profile
+	accounts map[string]api.ApiCtx
+	shell    *ishell.Shell
+	// script is the script being run, if any
+	script *script
 }
 
 func (ctx *ShellCtxt) prompt() string {
@@ -32,16 +37,11 @@ func setCustomCompleter(shell *ishell.Shell) {
 }
 
 func useHiddenFiles() bool {
-	val, ok := os.LookupEnv("RMAPI_USE_HIDDEN_FILES")
-
-	if !ok {
-		return false
-	}
-
-	return val != "0"
+	return config.Active().HiddenFiles
 }
 
-func RunShell(apiCtx api.ApiCtx, userInfo *api.UserInfo, args []string) error {
+// newShell creates the shell with all the commands
+func newShell(apiCtx api.ApiCtx, userInfo *api.UserInfo) (*ishell.Shell, *ShellCtxt) {
 	shell := ishell.New()
 	ctx := &ShellCtxt{
 		node:           apiCtx.Filetree().Root(),
@@ -49,6 +49,7 @@ func RunShell(apiCtx api.ApiCtx, userInfo *api.UserInfo, args []string) error {
 		path:           apiCtx.Filetree().Root().Name(),
 		useHiddenFiles: useHiddenFiles(),
 		UserInfo:       *userInfo,
+		shell:          shell,
 	}
 
 	shell.SetPrompt(ctx.prompt())
@@ -70,9 +71,30 @@ func RunShell(apiCtx api.ApiCtx, userInfo *api.UserInfo, args []string) error {
 	shell.AddCmd(nukeCmd(ctx))
 	shell.AddCmd(accountCmd(ctx))
 	shell.AddCmd(refreshCmd(ctx))
+	shell.AddCmd(transcribeCmd(ctx))
+	shell.AddCmd(mknoteCmd(ctx))
+	shell.AddCmd(updateCmd(ctx))
+	shell.AddCmd(backupCmd(ctx))
+	shell.AddCmd(restoreCmd(ctx))
+	shell.AddCmd(xcpCmd(ctx))
+	shell.AddCmd(watchCmd(ctx))
+	shell.AddCmd(exportDaemonCmd(ctx))
+	shell.AddCmd(inboxCmd(ctx))
+	shell.AddCmd(statusCmd(ctx))
+	shell.AddCmd(diffCmd(ctx))
+	shell.AddCmd(undoCmd(ctx))
+	shell.AddCmd(treeCmd(ctx))
+	shell.AddCmd(duCmd(ctx))
+	shell.AddCmd(sourceCmd(ctx))
 
 	setCustomCompleter(shell)
 
+	return shell, ctx
+}
+
+func RunShell(apiCtx api.ApiCtx, userInfo *api.UserInfo, args []string) error {
+	shell, _ := newShell(apiCtx, userInfo)
+
 	if len(args) > 0 {
 		return shell.Process(args...)
 	} else {
@@ -82,3 +104,9 @@ func RunShell(apiCtx api.ApiCtx, userInfo *api.UserInfo, args []string) error {
 		return nil
 	}
 }
+
+// RunScript runs the commands of a script file, or of the standard input when file is -
+func RunScript(apiCtx api.ApiCtx, userInfo *api.UserInfo, file string) error {
+	_, ctx := newShell(apiCtx, userInfo)
+	return ctx.runScript(file)
+}
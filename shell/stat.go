@@ -10,7 +10,7 @@ import (
 func statCmd(ctx *ShellCtxt) *ishell.Cmd {
 	return &ishell.Cmd{
 		Name:      "stat",
-		Help:      "fetch entry metadata",
+		Help:      "fetch entry metadata, usage: stat entry... (globs are expanded)",
 		Completer: createEntryCompleter(ctx),
 		Func: func(c *ishell.Context) {
 			if len(c.Args) == 0 {
@@ -18,23 +18,22 @@ func statCmd(ctx *ShellCtxt) *ishell.Cmd {
 				return
 			}
 
-			srcName := c.Args[0]
-
-			node, err := ctx.api.Filetree().NodeByPath(srcName, ctx.node)
-
+			nodes, err := ctx.resolveTargets(c.Args)
 			if err != nil {
-				c.Err(errors.New("file doesn't exist"))
+				c.Err(err)
 				return
 			}
 
-			jsn, err := json.MarshalIndent(node.Document, "", "  ")
+			for _, node := range nodes {
+				jsn, err := json.MarshalIndent(node.Document, "", "  ")
 
-			if err != nil {
-				c.Err(errors.New("can't serialize to json"))
-				return
-			}
+				if err != nil {
+					c.Err(errors.New("can't serialize to json"))
+					return
+				}
 
-			c.Println(string(jsn))
+				c.Println(string(jsn))
+			}
 		},
 	}
 }
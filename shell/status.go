@@ -0,0 +1,165 @@
+package shell
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/ishell"
+	"github.com/juruen/rmapi/api"
+	"github.com/juruen/rmapi/api/sync15"
+)
+
+var errNoDiff = errors.New("status and diff are only supported with the sync 1.5 API")
+
+func statusCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name: "status",
+		Help: "list the documents changed on the account since the last session",
+		Func: func(c *ishell.Context) {
+			d, ok := ctx.api.(api.DiffCtx)
+			if !ok {
+				c.Err(errNoDiff)
+				return
+			}
+
+			diff, err := d.Diff(false)
+			if err != nil {
+				c.Err(err)
+				return
+			}
+			if ctx.reloadNode() != nil {
+				c.SetPrompt(ctx.prompt())
+			}
+
+			if len(diff.Changes) == 0 {
+				c.Printf("no changes since the last session (generation %d)\n", diff.From)
+				return
+			}
+			c.Printf("%d changes since the last session (generation %d to %d)\n", len(diff.Changes), diff.From, diff.To)
+			for _, change := range diff.Changes {
+				c.Println(formatChange(change))
+			}
+		},
+	}
+}
+
+func diffCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name: "diff",
+		Help: "list the changes of the account with the pages of the modified documents, usage: diff [--since generation|time] [--json]",
+		Func: func(c *ishell.Context) {
+			flagSet := flag.NewFlagSet("diff", flag.ContinueOnError)
+			since := flagSet.String("since", "", "generation, date, RFC 3339 time or duration like 24h (default: the last session)")
+			asJson := flagSet.Bool("json", false, "print the changes as JSON")
+
+			if _, err := parseFlags(flagSet, c.Args); err != nil {
+				if err != flag.ErrHelp {
+					c.Err(err)
+				}
+				return
+			}
+
+			d, ok := ctx.api.(api.DiffCtx)
+			if !ok {
+				c.Err(errNoDiff)
+				return
+			}
+
+			var diff *sync15.Diff
+			var err error
+			if *since == "" {
+				diff, err = d.Diff(true)
+			} else if gen, convErr := strconv.ParseInt(*since, 10, 64); convErr == nil {
+				diff, err = d.DiffSinceGeneration(gen, true)
+			} else {
+				var t time.Time
+				if t, err = parseSince(*since); err == nil {
+					diff, err = d.DiffSinceTime(t, true)
+				}
+			}
+			if err != nil {
+				c.Err(err)
+				return
+			}
+			if ctx.reloadNode() != nil {
+				c.SetPrompt(ctx.prompt())
+			}
+
+			if *asJson {
+				out, err := json.MarshalIndent(diff, "", "  ")
+				if err != nil {
+					c.Err(err)
+					return
+				}
+				c.Println(string(out))
+				return
+			}
+
+			from := fmt.Sprintf("generation %d", diff.From)
+			if !diff.Since.IsZero() {
+				from += ", seen " + diff.Since.Format(time.RFC3339)
+			}
+			c.Printf("%d changes since %s\n", len(diff.Changes), from)
+			for _, change := range diff.Changes {
+				c.Println(formatChange(change))
+			}
+		},
+	}
+}
+
+// parseSince reads a date, an RFC 3339 time or a duration before now
+func parseSince(since string) (time.Time, error) {
+	if d, err := time.ParseDuration(since); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", since, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q, use a generation, a date, a time or a duration", since)
+}
+
+// formatChange prints a change on one line
+func formatChange(c sync15.Change) string {
+	line := fmt.Sprintf("%-9s%s", c.Type, c.Path)
+	if c.OldPath != "" {
+		line = fmt.Sprintf("%-9s%s -> %s", c.Type, c.OldPath, c.Path)
+	}
+
+	if c.Pages == nil {
+		return line
+	}
+	details := make([]string, 0)
+	for _, p := range []struct {
+		pages []int
+		what  string
+	}{
+		{c.Pages.Annotated, "annotated"},
+		{c.Pages.Added, "added"},
+		{c.Pages.Removed, "removed"},
+	} {
+		if len(p.pages) == 0 {
+			continue
+		}
+		numbers := make([]string, 0, len(p.pages))
+		for _, n := range p.pages {
+			numbers = append(numbers, strconv.Itoa(n))
+		}
+		noun := "page"
+		if len(p.pages) > 1 {
+			noun = "pages"
+		}
+		details = append(details, fmt.Sprintf("%s %s %s", noun, strings.Join(numbers, ", "), p.what))
+	}
+	if len(details) == 0 {
+		return line
+	}
+	return line + ": " + strings.Join(details, "; ")
+}
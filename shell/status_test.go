@@ -0,0 +1,20 @@
+package shell
+
+import (
+	"testing"
+
+	"github.com/juruen/rmapi/api/sync15"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatChange(t *testing.T) {
+	assert.Equal(t, "added    /Books/novel", formatChange(sync15.Change{Type: sync15.ChangeAdded, Path: "/Books/novel"}))
+	assert.Equal(t, "moved    /notes -> /trash/notes", formatChange(sync15.Change{Type: sync15.ChangeMoved, Path: "/trash/notes", OldPath: "/notes"}))
+
+	modified := sync15.Change{
+		Type:  sync15.ChangeModified,
+		Path:  "/Books/novel",
+		Pages: &sync15.PageChanges{Annotated: []int{2, 5}, Added: []int{6}},
+	}
+	assert.Equal(t, "modified /Books/novel: pages 2, 5 annotated; page 6 added", formatChange(modified))
+}
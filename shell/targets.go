@@ -0,0 +1,44 @@
+package shell
+
+import (
+	"fmt"
+
+	"github.com/juruen/rmapi/filetree"
+	"github.com/juruen/rmapi/model"
+)
+
+// resolveTargets returns the entries of the arguments of a command, expanding the globs.
+// An argument naming an existing entry is taken literally, even with glob characters in it.
+// An entry given several times, like a in "a a*", is only returned once.
+func (ctx *ShellCtxt) resolveTargets(args []string) ([]*model.Node, error) {
+	nodes := make([]*model.Node, 0, len(args))
+	seen := make(map[*model.Node]bool)
+	add := func(n *model.Node) {
+		if !seen[n] {
+			seen[n] = true
+			nodes = append(nodes, n)
+		}
+	}
+
+	for _, arg := range args {
+		if node, err := ctx.api.Filetree().NodeByPath(arg, ctx.node); err == nil {
+			add(node)
+			continue
+		}
+		if !filetree.HasGlob(arg) {
+			return nil, fmt.Errorf("entry %s doesn't exist", arg)
+		}
+
+		matches, err := ctx.api.Filetree().Glob(arg, ctx.node)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %v", arg, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no entry matches %s", arg)
+		}
+		for _, n := range matches {
+			add(n)
+		}
+	}
+	return nodes, nil
+}
@@ -0,0 +1,34 @@
+package shell
+
+import (
+	"testing"
+
+	"github.com/juruen/rmapi/api/local"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveTargets(t *testing.T) {
+	apiCtx, err := local.CreateCtx(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "ab"} {
+		dir, err := apiCtx.CreateDir("", name, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		apiCtx.Filetree().AddDocument(dir)
+	}
+	ctx := &ShellCtxt{api: apiCtx, node: apiCtx.Filetree().Root(), path: "/"}
+
+	nodes, err := ctx.resolveTargets([]string{"a", "a*"})
+	assert.NoError(t, err)
+	names := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		names = append(names, n.Name())
+	}
+	assert.Equal(t, []string{"a", "ab"}, names)
+
+	_, err = ctx.resolveTargets([]string{"missing*"})
+	assert.Error(t, err)
+}
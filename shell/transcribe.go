@@ -0,0 +1,88 @@
+package shell
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/abiosoft/ishell"
+	"github.com/juruen/rmapi/annotations"
+)
+
+func transcribeCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name:      "transcribe",
+		Help:      "convert the handwriting of a notebook to Markdown, usage: transcribe [-c command] [-o file.md] notebook",
+		Completer: createEntryCompleter(ctx),
+		Func: func(c *ishell.Context) {
+			flagSet := flag.NewFlagSet("transcribe", flag.ContinueOnError)
+			command := flagSet.String("c", "", "recognizer command, {} is replaced by the page image (default $"+annotations.RecognizerEnvVar+")")
+			output := flagSet.String("o", "", "output file (default <name>.md)")
+			if err := flagSet.Parse(c.Args); err != nil {
+				if err != flag.ErrHelp {
+					c.Err(err)
+				}
+				return
+			}
+			argRest := flagSet.Args()
+			if len(argRest) == 0 {
+				c.Err(errors.New("missing source file"))
+				return
+			}
+
+			var recognizer annotations.Recognizer
+			var err error
+			if *command != "" {
+				recognizer, err = annotations.NewCommandRecognizer(*command)
+			} else {
+				recognizer, err = annotations.DefaultRecognizer()
+			}
+			if err != nil {
+				c.Err(err)
+				return
+			}
+
+			srcName := argRest[0]
+
+			node, err := ctx.api.Filetree().NodeByPath(srcName, ctx.node)
+
+			if err != nil || node.IsDirectory() {
+				c.Err(errors.New("file doesn't exist"))
+				return
+			}
+
+			c.Println(fmt.Sprintf("downloading: [%s]...", srcName))
+
+			tmpDir, err := os.MkdirTemp("", "rmapi-transcribe")
+			if err != nil {
+				c.Err(err)
+				return
+			}
+			defer os.RemoveAll(tmpDir)
+
+			zipName := filepath.Join(tmpDir, "doc.zip")
+			err = ctx.api.FetchDocument(node.Document.ID, zipName)
+
+			if err != nil {
+				c.Err(fmt.Errorf("Failed to download file %s with %s", srcName, err.Error()))
+				return
+			}
+
+			mdName := *output
+			if mdName == "" {
+				mdName = fmt.Sprintf("%s.md", node.Name())
+			}
+			transcriber := annotations.CreateTranscriber(zipName, mdName, node.Name(), recognizer)
+			err = transcriber.Transcribe()
+
+			if err != nil {
+				c.Err(fmt.Errorf("Failed to transcribe %s with %s", srcName, err.Error()))
+				return
+			}
+
+			c.Printf("Transcription written to: %s\n", mdName)
+		},
+	}
+}
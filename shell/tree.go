@@ -0,0 +1,70 @@
+package shell
+
+import (
+	"errors"
+
+	"github.com/abiosoft/ishell"
+	"github.com/juruen/rmapi/filetree"
+	"github.com/juruen/rmapi/model"
+)
+
+func treeCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name:      "tree",
+		Help:      "print the entries under a directory as a tree, usage: tree [dir]",
+		Completer: createDirCompleter(ctx),
+		Func: func(c *ishell.Context) {
+			if len(c.Args) > 1 {
+				c.Err(errors.New("too many arguments for command tree"))
+				return
+			}
+
+			node := ctx.node
+			if len(c.Args) == 1 {
+				var err error
+				node, err = ctx.api.Filetree().NodeByPath(c.Args[0], ctx.node)
+				if err != nil || node.IsFile() {
+					c.Err(errors.New("directory doesn't exist"))
+					return
+				}
+			}
+
+			dirPath, err := ctx.api.Filetree().NodeToPath(node)
+			if err != nil {
+				dirPath = node.Name()
+			}
+			c.Println(dirPath)
+
+			dirs, files := printTree(c, node, "")
+			c.Printf("\n%d directories, %d files\n", dirs, files)
+		},
+	}
+}
+
+// printTree prints the entries under a directory with the prefix of their depth,
+// and returns the number of directories and files
+func printTree(c *ishell.Context, dir *model.Node, prefix string) (dirs, files int) {
+	entries := make([]*model.Node, 0, len(dir.Children))
+	for _, e := range dir.Children {
+		entries = append(entries, e)
+	}
+	sortNodes(entries, lsOptions{})
+
+	for i, e := range entries {
+		branch, indent := "├── ", "│   "
+		if i == len(entries)-1 {
+			branch, indent = "└── ", "    "
+		}
+		c.Println(prefix + branch + filetree.EntryName(e))
+
+		if e.IsFile() {
+			files++
+			continue
+		}
+		dirs++
+		d, f := printTree(c, e, prefix+indent)
+		dirs += d
+		files += f
+	}
+	return dirs, files
+}
@@ -0,0 +1,48 @@
+package shell
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/ishell"
+	"github.com/juruen/rmapi/api"
+)
+
+func undoCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name: "undo",
+		Help: "revert the last operations that changed the account, usage: undo [n]",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) > 1 {
+				c.Err(errors.New("too many arguments for command undo"))
+				return
+			}
+			n := 1
+			if len(c.Args) == 1 {
+				var err error
+				if n, err = strconv.Atoi(c.Args[0]); err != nil || n <= 0 {
+					c.Err(errors.New("the number of operations should be a positive integer"))
+					return
+				}
+			}
+
+			u, ok := ctx.api.(api.UndoCtx)
+			if !ok {
+				c.Err(errors.New("undo is only supported with the sync 1.5 API"))
+				return
+			}
+
+			records, err := u.Undo(n)
+			for _, r := range records {
+				c.Printf("undone: %s (generation %d)\n", strings.TrimPrefix(r.Operation, "undo "), r.Undoes)
+			}
+			if len(records) > 0 && ctx.reloadNode() != nil {
+				c.SetPrompt(ctx.prompt())
+			}
+			if err != nil {
+				c.Err(err)
+			}
+		},
+	}
+}
@@ -0,0 +1,131 @@
+package shell
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/abiosoft/ishell"
+	"github.com/juruen/rmapi/annotations"
+	"github.com/juruen/rmapi/archive"
+	"github.com/juruen/rmapi/util"
+)
+
+func updateCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name:      "update",
+		Help:      "replace the pdf of a document keeping its annotations, usage: update [--map 1-3,-,4] document new.pdf",
+		Completer: createFileCompleter(ctx),
+		Func: func(c *ishell.Context) {
+			flagSet := flag.NewFlagSet("update", flag.ContinueOnError)
+			pageMap := flagSet.String("map", "", "original page of every new page, e.g. 1-3,-,4")
+
+			args, err := parseFlags(flagSet, c.Args)
+			if err != nil {
+				if err != flag.ErrHelp {
+					c.Err(err)
+				}
+				return
+			}
+
+			if len(args) != 2 {
+				c.Err(errors.New("missing document or source file"))
+				return
+			}
+
+			node, err := ctx.api.Filetree().NodeByPath(args[0], ctx.node)
+			if err != nil || node.IsDirectory() {
+				c.Err(errors.New("document doesn't exist"))
+				return
+			}
+
+			srcName := args[1]
+			if _, ext := util.DocPathToName(srcName); ext != util.PDF {
+				c.Err(errors.New("the new version has to be a pdf"))
+				return
+			}
+
+			tmpDir, err := os.MkdirTemp("", "rmupdate")
+			if err != nil {
+				c.Err(err)
+				return
+			}
+			defer os.RemoveAll(tmpDir)
+
+			zipPath := filepath.Join(tmpDir, "current.zip")
+			if err = ctx.api.FetchDocument(node.Document.ID, zipPath); err != nil {
+				c.Err(fmt.Errorf("failed to download document %v", err))
+				return
+			}
+
+			matches, err := matchPages(zipPath, srcName, *pageMap, tmpDir)
+			if err != nil {
+				c.Err(err)
+				return
+			}
+
+			updatedPath := filepath.Join(tmpDir, "updated.zip")
+			if err = archive.UpdatePayload(zipPath, srcName, matches, updatedPath); err != nil {
+				c.Err(err)
+				return
+			}
+
+			c.Printf("updating: [%s]...", node.Name())
+
+			document, err := ctx.api.ReplaceDocument(node.Document.ID, updatedPath, true)
+			if err != nil {
+				c.Err(fmt.Errorf("Failed to update document [%s] %v", node.Name(), err))
+				return
+			}
+
+			c.Println("OK")
+
+			ctx.api.Filetree().AddDocument(document)
+		},
+	}
+}
+
+// matchPages finds the page of the current document matching each page of srcName,
+// either from the given page map or comparing the text of both documents
+func matchPages(zipPath, srcName, pageMap, tmpDir string) ([]int, error) {
+	src, err := os.Open(srcName)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	if pageMap != "" {
+		matches, err := parsePageMap(pageMap)
+		if err != nil {
+			return nil, err
+		}
+
+		pageCount, err := annotations.PageCount(src)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) > pageCount {
+			return nil, fmt.Errorf("the page map has %d pages but the document only %d", len(matches), pageCount)
+		}
+		for len(matches) < pageCount {
+			matches = append(matches, -1)
+		}
+
+		return matches, nil
+	}
+
+	currentPath := filepath.Join(tmpDir, "current.pdf")
+	if err = archive.ReadPayload(zipPath, currentPath); err != nil {
+		return nil, err
+	}
+
+	current, err := os.Open(currentPath)
+	if err != nil {
+		return nil, err
+	}
+	defer current.Close()
+
+	return annotations.MatchPages(current, src)
+}
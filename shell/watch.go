@@ -0,0 +1,139 @@
+package shell
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+
+	"github.com/abiosoft/ishell"
+	shlex "github.com/flynn-archive/go-shlex"
+	"github.com/juruen/rmapi/api"
+	"github.com/juruen/rmapi/api/sync15"
+	"github.com/juruen/rmapi/log"
+)
+
+const webhookTimeout = 30 * time.Second
+
+func watchCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name: "watch",
+		Help: "print a JSON event for each change of the account until interrupted, usage: watch [--interval 30s] [--exec cmd] [--webhook url]",
+		Func: func(c *ishell.Context) {
+			flagSet := flag.NewFlagSet("watch", flag.ContinueOnError)
+			interval := flagSet.Duration("interval", 30*time.Second, "time between two checks of the account")
+			command := flagSet.String("exec", "", "command run for each event, with the event on its input")
+			webhook := flagSet.String("webhook", "", "url the events are posted to")
+
+			if _, err := parseFlags(flagSet, c.Args); err != nil {
+				if err != flag.ErrHelp {
+					c.Err(err)
+				}
+				return
+			}
+
+			w, ok := ctx.api.(api.WatchCtx)
+			if !ok {
+				c.Err(errors.New("watch is only supported with the sync 1.5 API"))
+				return
+			}
+			if *interval <= 0 {
+				c.Err(errors.New("the interval should be positive"))
+				return
+			}
+
+			var args []string
+			if *command != "" {
+				var err error
+				if args, err = shlex.Split(*command); err != nil || len(args) == 0 {
+					c.Err(fmt.Errorf("invalid command %q", *command))
+					return
+				}
+			}
+
+			interrupt := make(chan os.Signal, 1)
+			signal.Notify(interrupt, os.Interrupt)
+			defer signal.Stop(interrupt)
+
+			ticker := time.NewTicker(*interval)
+			defer ticker.Stop()
+
+			for {
+				changes, err := w.Changes()
+				if err != nil {
+					// the next check may succeed, e.g. after a network error
+					log.Warning.Println("failed to check for changes:", err)
+				}
+				if len(changes) > 0 && ctx.reloadNode() != nil {
+					c.SetPrompt(ctx.prompt())
+				}
+
+				for _, change := range changes {
+					event, err := json.Marshal(change)
+					if err != nil {
+						c.Err(err)
+						return
+					}
+					c.Println(string(event))
+
+					if args != nil {
+						if err := runEventCommand(args, change, event); err != nil {
+							log.Warning.Println(err)
+						}
+					}
+					if *webhook != "" {
+						if err := postEvent(*webhook, event); err != nil {
+							log.Warning.Println(err)
+						}
+					}
+				}
+
+				select {
+				case <-interrupt:
+					return
+				case <-ticker.C:
+				}
+			}
+		},
+	}
+}
+
+// runEventCommand runs the command of watch with the event on its input
+// and its main fields in the environment
+func runEventCommand(args []string, change sync15.Change, event []byte) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(event)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"RMAPI_EVENT_TYPE="+string(change.Type),
+		"RMAPI_EVENT_ID="+change.ID,
+		"RMAPI_EVENT_PATH="+change.Path,
+	)
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command of the %s event of %s failed: %v", change.Type, change.Path, err)
+	}
+	return nil
+}
+
+// postEvent posts the event to the webhook url
+func postEvent(url string, event []byte) error {
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(event))
+	if err != nil {
+		return fmt.Errorf("failed to post the event: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to post the event: status %d", resp.StatusCode)
+	}
+	return nil
+}
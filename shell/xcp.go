@@ -0,0 +1,120 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/abiosoft/ishell"
+	"github.com/juruen/rmapi/api"
+	"github.com/juruen/rmapi/config"
+	"github.com/juruen/rmapi/model"
+)
+
+func xcpCmd(ctx *ShellCtxt) *ishell.Cmd {
+	return &ishell.Cmd{
+		Name:      "xcp",
+		Help:      "copy a file or directory to another account, usage: xcp [profile:]src [profile:]dst",
+		Completer: createEntryCompleter(ctx),
+		Func: func(c *ishell.Context) {
+			if len(c.Args) != 2 {
+				c.Err(errors.New("missing source and/or destination"))
+				return
+			}
+
+			srcProfile, src := splitProfilePath(c.Args[0])
+			dstProfile, dst := splitProfilePath(c.Args[1])
+
+			srcCtx, srcDir, err := ctx.account(srcProfile)
+			if err != nil {
+				c.Err(err)
+				return
+			}
+			dstCtx, dstDir, err := ctx.account(dstProfile)
+			if err != nil {
+				c.Err(err)
+				return
+			}
+
+			srcNode, err := srcCtx.Filetree().NodeByPath(src, srcDir)
+			if err != nil || srcNode.IsRoot() {
+				c.Err(errors.New("source entry doesn't exist"))
+				return
+			}
+
+			name := srcNode.Name()
+			dstNode, err := dstCtx.Filetree().NodeByPath(dst, dstDir)
+			if err == nil && dstNode.IsFile() {
+				c.Err(errors.New("destination entry already exists"))
+				return
+			}
+			if err != nil {
+				// copying with a new name
+				name = path.Base(dst)
+				dstNode, err = dstCtx.Filetree().NodeByPath(path.Dir(dst), dstDir)
+				if err != nil || dstNode.IsFile() {
+					c.Err(errors.New("directory doesn't exist"))
+					return
+				}
+			}
+			if _, err = dstNode.FindByName(name); err == nil {
+				c.Err(errors.New("entry already exists"))
+				return
+			}
+
+			c.Printf("copying: [%s]...", c.Args[0])
+			documents, err := api.CopyEntry(srcCtx, srcNode, dstCtx, dstNode, name)
+			if err != nil {
+				c.Err(fmt.Errorf("failed to copy entry: %v", err))
+				return
+			}
+
+			for _, d := range documents {
+				dstCtx.Filetree().AddDocument(d)
+			}
+			c.Printf("OK, %d entries\n", len(documents))
+		},
+	}
+}
+
+// account returns the api of the account named profile, and the directory where
+// its relative paths start. Accounts other than the one of the shell are opened once.
+func (ctx *ShellCtxt) account(profile string) (api.ApiCtx, *model.Node, error) {
+	if profile == "" || profile == ctx.UserInfo.Profile {
+		return ctx.api, ctx.node, nil
+	}
+
+	if a, ok := ctx.accounts[profile]; ok {
+		return a, a.Filetree().Root(), nil
+	}
+
+	// only the cloud is opened for another profile, the local and usb backends need the flags of the shell
+	settings, err := config.Settings(profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if settings.Backend != "cloud" {
+		return nil, nil, fmt.Errorf("profile %s uses the %s backend, xcp only copies between cloud accounts", profile, settings.Backend)
+	}
+
+	if !api.ProfileLoggedIn(profile) {
+		return nil, nil, fmt.Errorf("profile %s is not logged in, run rmapi -profile %s first", profile, profile)
+	}
+
+	a, _, err := api.CreateCloudApiCtx(profile, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't open profile %s: %v", profile, err)
+	}
+	// nothing is written to the other accounts either in dry-run mode
+	if d, ok := ctx.api.(*api.DryRunCtx); ok {
+		if a, err = d.DryRun(a); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if ctx.accounts == nil {
+		ctx.accounts = make(map[string]api.ApiCtx)
+	}
+	ctx.accounts[profile] = a
+	return a, a.Filetree().Root(), nil
+}
@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,8 +11,10 @@ import (
 	"net/http/httputil"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/golang-jwt/jwt"
 	"github.com/juruen/rmapi/log"
 	"github.com/juruen/rmapi/model"
 	"github.com/juruen/rmapi/util"
@@ -36,20 +39,81 @@ const (
 
 const (
 	EmptyBody string = ""
+
+	// expiryMargin is how long before its expiry the user token is renewed
+	expiryMargin = time.Minute
 )
 
 type HttpClientCtx struct {
 	Client *http.Client
 	Tokens model.AuthTokens
+
+	renewal *tokenRenewal
+}
+
+// tokenRenewal renews the user token of an HttpClientCtx, the mutex
+// avoids several renewals at the same time
+type tokenRenewal struct {
+	mu    sync.Mutex
+	renew func() (string, error)
+	save  func(model.AuthTokens)
 }
 
 func CreateHttpClientCtx(tokens model.AuthTokens) HttpClientCtx {
 	var httpClient = &http.Client{Timeout: 5 * 60 * time.Second}
 
-	return HttpClientCtx{httpClient, tokens}
+	return HttpClientCtx{Client: httpClient, Tokens: tokens}
 }
 
-func (ctx HttpClientCtx) addAuthorization(req *http.Request, authType AuthType) {
+// SetTokenRenewal makes the requests with the user token renew it with renew when
+// it's about to expire or when it's rejected, and then replay the request.
+// save is called with the renewed tokens to persist them.
+func (ctx *HttpClientCtx) SetTokenRenewal(renew func() (string, error), save func(model.AuthTokens)) {
+	ctx.renewal = &tokenRenewal{renew: renew, save: save}
+}
+
+// userToken returns the user token to use. It's renewed first when it's about
+// to expire or when it's still the rejected one.
+func (ctx *HttpClientCtx) userToken(rejected string) (string, error) {
+	r := ctx.renewal
+	if r == nil {
+		return ctx.Tokens.UserToken, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token := ctx.Tokens.UserToken
+	if token != rejected && !expiresSoon(token) {
+		return token, nil
+	}
+
+	log.Info.Println("renewing the user token")
+	token, err := r.renew()
+	if err != nil {
+		return "", err
+	}
+
+	ctx.Tokens.UserToken = token
+	if r.save != nil {
+		r.save(ctx.Tokens)
+	}
+
+	return token, nil
+}
+
+// expiresSoon tells whether the JWT token expires within expiryMargin,
+// a token that can't be parsed is left to the server
+func expiresSoon(token string) bool {
+	claims := jwt.StandardClaims{}
+	if _, _, err := (&jwt.Parser{}).ParseUnverified(token, &claims); err != nil {
+		return false
+	}
+
+	return !claims.VerifyExpiresAt(time.Now().Add(expiryMargin).Unix(), false)
+}
+
+func (ctx *HttpClientCtx) addAuthorization(req *http.Request, authType AuthType, userToken string) {
 	var header string
 
 	switch authType {
@@ -58,13 +122,13 @@ func (ctx HttpClientCtx) addAuthorization(req *http.Request, authType AuthType)
 	case DeviceBearer:
 		header = fmt.Sprintf("Bearer %s", ctx.Tokens.DeviceToken)
 	case UserBearer:
-		header = fmt.Sprintf("Bearer %s", ctx.Tokens.UserToken)
+		header = fmt.Sprintf("Bearer %s", userToken)
 	}
 
 	req.Header.Add("Authorization", header)
 }
 
-func (ctx HttpClientCtx) Get(authType AuthType, url string, body interface{}, target interface{}) error {
+func (ctx *HttpClientCtx) Get(authType AuthType, url string, body interface{}, target interface{}) error {
 	bodyReader, err := util.ToIOReader(body)
 
 	if err != nil {
@@ -85,7 +149,7 @@ func (ctx HttpClientCtx) Get(authType AuthType, url string, body interface{}, ta
 	return json.NewDecoder(response.Body).Decode(target)
 }
 
-func (ctx HttpClientCtx) GetStream(authType AuthType, url string) (io.ReadCloser, error) {
+func (ctx *HttpClientCtx) GetStream(authType AuthType, url string) (io.ReadCloser, error) {
 	response, err := ctx.Request(authType, http.MethodGet, url, strings.NewReader(""))
 
 	var respBody io.ReadCloser
@@ -96,23 +160,23 @@ func (ctx HttpClientCtx) GetStream(authType AuthType, url string) (io.ReadCloser
 	return respBody, err
 }
 
-func (ctx HttpClientCtx) Post(authType AuthType, url string, reqBody, resp interface{}) error {
+func (ctx *HttpClientCtx) Post(authType AuthType, url string, reqBody, resp interface{}) error {
 	return ctx.httpRawReq(authType, http.MethodPost, url, reqBody, resp)
 }
 
-func (ctx HttpClientCtx) Put(authType AuthType, url string, reqBody, resp interface{}) error {
+func (ctx *HttpClientCtx) Put(authType AuthType, url string, reqBody, resp interface{}) error {
 	return ctx.httpRawReq(authType, http.MethodPut, url, reqBody, resp)
 }
 
-func (ctx HttpClientCtx) PutStream(authType AuthType, url string, reqBody io.Reader) error {
+func (ctx *HttpClientCtx) PutStream(authType AuthType, url string, reqBody io.Reader) error {
 	return ctx.httpRawReq(authType, http.MethodPut, url, reqBody, nil)
 }
 
-func (ctx HttpClientCtx) Delete(authType AuthType, url string, reqBody, resp interface{}) error {
+func (ctx *HttpClientCtx) Delete(authType AuthType, url string, reqBody, resp interface{}) error {
 	return ctx.httpRawReq(authType, http.MethodDelete, url, reqBody, resp)
 }
 
-func (ctx HttpClientCtx) httpRawReq(authType AuthType, verb, url string, reqBody, resp interface{}) error {
+func (ctx *HttpClientCtx) httpRawReq(authType AuthType, verb, url string, reqBody, resp interface{}) error {
 	var contentBody io.Reader
 
 	switch reqBody.(type) {
@@ -164,13 +228,81 @@ func (ctx HttpClientCtx) httpRawReq(authType AuthType, verb, url string, reqBody
 	return nil
 }
 
-func (ctx HttpClientCtx) Request(authType AuthType, verb, url string, body io.Reader) (*http.Response, error) {
+// Request sends a request with the authorization authType. When the user token is
+// renewed on the way, the body is replayed so it's buffered unless it can be rewound.
+func (ctx *HttpClientCtx) Request(authType AuthType, verb, url string, body io.Reader) (*http.Response, error) {
+	if authType != UserBearer || ctx.renewal == nil {
+		return ctx.request(authType, ctx.Tokens.UserToken, verb, url, body)
+	}
+
+	rewind, err := replayable(&body)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := ctx.userToken("")
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := ctx.request(authType, token, verb, url, body)
+	if err != ErrUnauthorized {
+		return response, err
+	}
+
+	token, renewErr := ctx.userToken(token)
+	if renewErr != nil {
+		log.Warning.Println("failed to renew the user token:", renewErr)
+		return response, err
+	}
+	if err = rewind(); err != nil {
+		return response, err
+	}
+	response.Body.Close()
+
+	log.Trace.Println("replaying the request with the renewed token")
+	return ctx.request(authType, token, verb, url, body)
+}
+
+// replayable makes the body readable again after a request, it returns the
+// function that rewinds it
+func replayable(body *io.Reader) (func() error, error) {
+	if *body == nil {
+		return func() error { return nil }, nil
+	}
+
+	if seeker, ok := (*body).(io.Seeker); ok {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			// hide Close, the client would close a file after the first request
+			*body = struct{ io.Reader }{*body}
+			return func() error {
+				_, err := seeker.Seek(offset, io.SeekStart)
+				return err
+			}, nil
+		}
+	}
+
+	content, err := ioutil.ReadAll(*body)
+	if err != nil {
+		return nil, err
+	}
+	reader := bytes.NewReader(content)
+	*body = reader
+
+	return func() error {
+		_, err := reader.Seek(0, io.SeekStart)
+		return err
+	}, nil
+}
+
+func (ctx *HttpClientCtx) request(authType AuthType, userToken, verb, url string, body io.Reader) (*http.Response, error) {
 	request, err := http.NewRequest(verb, url, body)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx.addAuthorization(request, authType)
+	ctx.addAuthorization(request, authType, userToken)
 	request.Header.Add("User-Agent", RmapiUserAGent)
 
 	if log.TracingEnabled {
@@ -207,7 +339,7 @@ func (ctx HttpClientCtx) Request(authType AuthType, verb, url string, body io.Re
 	}
 }
 
-func (ctx HttpClientCtx) GetBlobStream(url string) (io.ReadCloser, int64, error) {
+func (ctx *HttpClientCtx) GetBlobStream(url string) (io.ReadCloser, int64, error) {
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, 0, err
@@ -258,7 +390,7 @@ func addGenerationMatchHeader(req *http.Request, gen int64) {
 	}
 }
 
-func (ctx HttpClientCtx) PutRootBlobStream(url string, gen, maxRequestSize int64, reader io.Reader) (newGeneration int64, err error) {
+func (ctx *HttpClientCtx) PutRootBlobStream(url string, gen, maxRequestSize int64, reader io.Reader) (newGeneration int64, err error) {
 	req, err := http.NewRequest(http.MethodPut, url, reader)
 	if err != nil {
 		return
@@ -307,7 +439,7 @@ func (ctx HttpClientCtx) PutRootBlobStream(url string, gen, maxRequestSize int64
 
 	return
 }
-func (ctx HttpClientCtx) PutBlobStream(url string, reader io.Reader, maxRequestSize int64) (err error) {
+func (ctx *HttpClientCtx) PutBlobStream(url string, reader io.Reader, maxRequestSize int64) (err error) {
 	req, err := http.NewRequest(http.MethodPut, url, reader)
 	if err != nil {
 		return
@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/juruen/rmapi/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func testToken(t *testing.T, expiresAt time.Time) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
+		ExpiresAt: expiresAt.Unix(),
+	}).SignedString([]byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestTokenRenewal(t *testing.T) {
+	valid := testToken(t, time.Now().Add(time.Hour))
+	renewed := testToken(t, time.Now().Add(2*time.Hour))
+
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if r.Header.Get("Authorization") != "Bearer "+renewed {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	for name, token := range map[string]string{
+		"expired":  testToken(t, time.Now().Add(-time.Hour)),
+		"rejected": valid,
+	} {
+		t.Run(name, func(t *testing.T) {
+			bodies = nil
+			renewals := 0
+			var saved model.AuthTokens
+
+			ctx := CreateHttpClientCtx(model.AuthTokens{DeviceToken: "device", UserToken: token})
+			ctx.SetTokenRenewal(func() (string, error) {
+				renewals++
+				return renewed, nil
+			}, func(tokens model.AuthTokens) {
+				saved = tokens
+			})
+
+			resp := BodyString{}
+			err := ctx.Post(UserBearer, server.URL, strings.NewReader("content"), &resp)
+			assert.NoError(t, err)
+			assert.Equal(t, "ok", resp.Content)
+			assert.Equal(t, 1, renewals)
+			assert.Equal(t, renewed, saved.UserToken)
+			assert.Equal(t, "device", saved.DeviceToken)
+			assert.Equal(t, renewed, ctx.Tokens.UserToken)
+			for _, b := range bodies {
+				assert.Equal(t, "content", b)
+			}
+		})
+	}
+}
+
+func TestNoTokenRenewal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	ctx := CreateHttpClientCtx(model.AuthTokens{UserToken: "token"})
+	err := ctx.Post(UserBearer, server.URL, nil, nil)
+	assert.Equal(t, ErrUnauthorized, err)
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 )
 
@@ -14,13 +15,31 @@ const (
 	ZIP  = "zip"
 	RM   = "rm"
 	EPUB = "epub"
+	MD   = "md"
+	HTML = "html"
+	HTM  = "htm"
+	TXT  = "txt"
+	PNG  = "png"
+	JPG  = "jpg"
+	JPEG = "jpeg"
+	DOCX = "docx"
 )
 
+// supportedExt lists the extensions that can be uploaded,
+// the ones not natively supported by the tablet are converted first
 var supportedExt = map[string]bool{
 	EPUB: true,
 	PDF:  true,
 	ZIP:  true,
 	RM:   true,
+	MD:   true,
+	HTML: true,
+	HTM:  true,
+	TXT:  true,
+	PNG:  true,
+	JPG:  true,
+	JPEG: true,
+	DOCX: true,
 }
 
 func IsFileTypeSupported(ext string) bool {
@@ -69,6 +88,32 @@ func CopyFile(src, dst string) (int64, error) {
 	return n, nil
 }
 
+// WriteFileAtomic writes a file through a temporary file in the same directory renamed over it,
+// so a crash never leaves a partial file
+func WriteFileAtomic(file string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
 // Wraps a request in a slice (serialize as json array)
 func InSlice(req interface{}) []interface{} {
 	slice := make([]interface{}, 0)